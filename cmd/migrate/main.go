@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"library-system/migrations"
+	"library-system/pkg/config"
+	"library-system/pkg/db"
+	"library-system/pkg/migrate"
+
+	"github.com/joho/godotenv"
+)
+
+const usage = `Usage: go run ./cmd/migrate [-config file] [-database.dsn dsn] <command>
+
+Commands:
+  up        apply all pending migrations
+  down [n]  revert the latest n applied migrations (default 1)
+  status    list migrations and when they were applied
+  redo      revert and re-apply the latest applied migration
+`
+
+func main() {
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found")
+	}
+
+	cfg, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(0)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(cfg.Args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err := cfg.ValidateDatabase(); err != nil {
+		log.Fatal(err)
+	}
+	if err := db.InitDB(cfg.Database); err != nil {
+		log.Fatal(err)
+	}
+	defer db.DB.Close()
+
+	m, err := migrate.New(db.DB, migrations.FS)
+	if err != nil {
+		log.Fatal(err)
+	}
+	ctx := context.Background()
+
+	switch cfg.Args[0] {
+	case "up":
+		n, err := m.Up(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("%d migrations applied\n", n)
+	case "down":
+		steps := 1
+		if len(cfg.Args) > 1 {
+			if steps, err = strconv.Atoi(cfg.Args[1]); err != nil || steps < 1 {
+				log.Fatalf("invalid step count %q", cfg.Args[1])
+			}
+		}
+		n, err := m.Down(ctx, steps)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("%d migrations reverted\n", n)
+	case "status":
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, s := range statuses {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Local().Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(w, "%03d\t%s\t%s\n", s.Version, s.Name, applied)
+		}
+		w.Flush()
+	case "redo":
+		if err := m.Redo(ctx); err != nil {
+			log.Fatal(err)
+		}
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
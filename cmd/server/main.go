@@ -1,29 +1,51 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
 	"time"
 
+	"library-system/migrations"
+	"library-system/pkg/admin"
+	"library-system/pkg/audit"
 	"library-system/pkg/auth"
+	"library-system/pkg/cache"
+	"library-system/pkg/circulation"
+	"library-system/pkg/config"
+	"library-system/pkg/cors"
 	"library-system/pkg/db"
+	"library-system/pkg/gqlrequest"
+	"library-system/pkg/health"
+	"library-system/pkg/httpx"
+	"library-system/pkg/idempotency"
+	"library-system/pkg/jobs"
+	"library-system/pkg/logging"
+	"library-system/pkg/metrics"
+	"library-system/pkg/migrate"
+	"library-system/pkg/ratelimit"
+	"library-system/pkg/repository"
 	"library-system/pkg/schema"
-
-	_ "net/http/pprof" // Register pprof handlers
+	"library-system/pkg/tracing"
 
 	"github.com/gorilla/mux"
 	"github.com/graphql-go/handler"
 	"github.com/joho/godotenv"
 )
 
-func loggingMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
-		next.ServeHTTP(w, r)
-		log.Printf("Request: %s %s took %v", r.Method, r.URL.Path, time.Since(start))
-	})
+// fatal logs err and exits; use it once logging is configured
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
 }
 
 func main() {
@@ -32,56 +54,270 @@ func main() {
 		log.Println("No .env file found")
 	}
 
-	// Connection string - in a real app, use environment variables
-	// Default: host=localhost port=5432 user=postgres password=password dbname=library sslmode=disable
-	connStr := "host=localhost port=5432 user=postgres password=password dbname=library sslmode=disable"
-	if envConn := os.Getenv("DB_CONNECTION_STRING"); envConn != "" {
-		connStr = envConn
+	cfg, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		log.Fatal("Failed to load configuration: ", err)
+	}
+	if cfg.PrintConfig {
+		fmt.Print(cfg)
+		os.Exit(0)
+	}
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Invalid configuration:\n%v", err)
+	}
+	if err := logging.Init(cfg.Log); err != nil {
+		log.Fatal("Failed to set up logging: ", err)
 	}
+	slog.Info("effective configuration", "config", cfg.String())
 
-	db.InitDB(connStr)
+	// Tracing comes first so the database driver is instrumented from the start
+	shutdownTracing, err := tracing.Init(context.Background(), cfg.Tracing)
+	if err != nil {
+		fatal("failed to set up tracing", err)
+	}
+
+	if err := db.InitDB(cfg.Database); err != nil {
+		fatal("failed to connect to database", err)
+	}
+	migrator, err := migrate.New(db.DB, migrations.FS)
+	if err != nil {
+		fatal("failed to load migrations", err)
+	}
+	if cfg.Server.MigrateOnBoot {
+		n, err := migrator.Up(context.Background())
+		if err != nil {
+			fatal("failed to migrate database", err)
+		}
+		slog.Info("migrations applied", "count", n)
+	}
+	// Serialization failures and deadlocks are retried per cfg.Transactions;
+	// reads outside transactions go to the replica when there is one
+	store := repository.NewPostgresStore(db.DB).WithTxOptions(cfg.Transactions)
+	if db.Replica != nil {
+		store = store.WithReplica(db.Replica)
+	}
+	// Book lists read through an in-process cache that book writes and
+	// circulation invalidate
+	var cachedStore repository.Store = store
+	if cfg.Cache.Enabled {
+		cachedStore = repository.NewCachedStore(store, cache.NewLRU("catalog", repository.CatalogEntries), cfg.Cache)
+	}
 
 	// Create GraphQL Schema handler
+	loans := circulation.NewService(cachedStore, cfg.Circulation)
+	librarySchema, err := schema.New(cachedStore, loans, schema.Config{
+		ResolverTimeout: cfg.Server.ResolverTimeout,
+		IdempotencyTTL:  cfg.Idempotency.KeyTTL,
+	})
+	if err != nil {
+		fatal("failed to build GraphQL schema", err)
+	}
+	librarySchema.AddExtensions(metrics.GraphQL{}, tracing.GraphQL{}, logging.GraphQL{})
 	h := handler.New(&handler.Config{
-		Schema:   &schema.LibrarySchema,
-		Pretty:   true,
-		GraphiQL: true,
+		Schema:   &librarySchema,
+		Pretty:   cfg.Server.PrettyJSON,
+		GraphiQL: cfg.Server.GraphiQL,
 	})
 
 	// Init Auth
-	auth.InitAuth()
+	if err := auth.InitAuth(store.Users(), store.APIKeys(), cfg.Auth); err != nil {
+		fatal("failed to set up authentication", err)
+	}
+
+	// Rate limiting per principal, or per client IP for anonymous requests
+	limiter := ratelimit.New(ratelimit.NewMemoryStore(), cfg.RateLimit)
+
+	// Background jobs: purge soft-deleted books and members after the retention
+	// period and drop expired idempotency keys
+	var runner jobs.Runner
+	runner.Add(jobs.Purge(cachedStore, cfg.Jobs.SoftDeleteRetention, cfg.Jobs.PurgeInterval))
+	runner.Add(idempotency.CleanupJob(store, cfg.Idempotency.CleanupInterval))
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	runner.Start(jobsCtx)
+
+	// Raised once the listener is up, lowered as soon as shutdown begins
+	var readiness health.Readiness
+	checker := health.NewChecker(&readiness, cfg.Server.HealthTimeout)
+	checker.Add("database", db.DB.PingContext)
+	if db.Replica != nil {
+		checker.Add("replica", db.Replica.PingContext)
+	}
+	checker.Add("migrations", func(ctx context.Context) error {
+		pending, err := migrator.Pending(ctx)
+		if err != nil {
+			return err
+		}
+		if len(pending) > 0 {
+			return fmt.Errorf("%d pending, first is %03d_%s", len(pending), pending[0].Version, pending[0].Name)
+		}
+		return nil
+	})
+	checker.Add("auth", func(context.Context) error { return auth.Check() })
 
 	r := mux.NewRouter()
-	r.Use(loggingMiddleware)
+	r.Use(httpx.RequestMetadata(cfg.Server.TrustedProxies))
+	r.Use(tracing.Middleware)
+	r.Use(logging.Middleware)
+	r.Use(metrics.Middleware)
+	// Innermost, so the logged and measured sizes are what went over the wire
+	if cfg.Server.Compression {
+		r.Use(httpx.Compress(cfg.Server.CompressMinSize))
+	}
+
+	// Probes for the orchestrator: liveness never touches dependencies
+	r.Handle("/healthz", health.LiveHandler()).Methods(http.MethodGet)
+	// Each probe pings the database, so anonymous callers are throttled
+	r.Handle("/readyz", limiter.IPHandler(checker.ReadyHandler())).Methods(http.MethodGet)
+
+	// Prometheus metrics
+	metrics.RegisterDB(db.DB, "library")
+	if db.Replica != nil {
+		metrics.RegisterDB(db.Replica, "library_replica")
+	}
+	metrics.RegisterGauge("library_loans_overdue", "Active loans past their due date.", func(ctx context.Context) (float64, error) {
+		n, err := loans.CountOverdue(ctx)
+		return float64(n), err
+	})
+	r.Handle("/metrics", metrics.Handler()).Methods(http.MethodGet)
 
 	// Auth Routes
-	r.HandleFunc("/auth/google/login", auth.GoogleLoginHandler)
-	r.HandleFunc("/auth/google/callback", auth.GoogleCallbackHandler)
-	r.Handle("/auth/me", auth.AuthMiddleware(http.HandlerFunc(auth.MeHandler)))
+	for _, p := range auth.RedirectProviders() {
+		r.Handle("/auth/"+p.Name()+"/login", limiter.AuthHandler(auth.LoginHandler(p)))
+		r.Handle("/auth/"+p.Name()+"/callback", limiter.AuthHandler(auth.CallbackHandler(p)))
+	}
+	r.Handle("/auth/local/login", limiter.AuthHandler(http.HandlerFunc(auth.LocalLoginHandler))).Methods(http.MethodPost)
+
+	// The per-IP budget runs before authentication, so anonymous requests and
+	// guessed API keys are throttled too; authenticated traffic is then
+	// limited per principal
+	authenticated := func(h http.Handler) http.Handler {
+		return limiter.IPHandler(auth.AuthMiddleware(h))
+	}
+	r.Handle("/auth/me", authenticated(http.HandlerFunc(auth.MeHandler)))
+	r.Handle("/auth/csrf", authenticated(http.HandlerFunc(auth.CSRFTokenHandler)))
 
-	// Protected GraphQL endpoint (Optional: apply to all or specific)
-	// For now, keeping public, but here is how to protect it:
-	r.Handle("/graphql", auth.AuthMiddleware(h))
-	//r.Handle("/graphql", h)
+	// Protected GraphQL endpoint; production hides the schema from the public.
+	// Repeated GET queries with If-None-Match get 304 when nothing changed.
+	// The request is decoded once, after the per-IP budget, for the
+	// middlewares that look at the operation.
+	graphqlChain := func(h http.Handler) http.Handler {
+		return authenticated(gqlrequest.Middleware(limiter.Handler(auth.CSRFMiddleware(idempotency.Middleware(h)))))
+	}
+	if !cfg.Server.Introspection {
+		r.Handle("/graphql", graphqlChain(gqlrequest.BlockIntrospection(gqlrequest.ConditionalGET(h))))
+	} else {
+		r.Handle("/graphql", graphqlChain(gqlrequest.ConditionalGET(h)))
+	}
+
+	// Audit log export (ADMIN only)
+	r.Handle("/admin/audit-log.csv", authenticated(audit.CSVHandler(store.AuditLog()))).Methods(http.MethodGet)
 
 	// Example protected route
-	r.Handle("/api/me", auth.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	r.Handle("/api/me", authenticated(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte("You are authenticated!"))
 	})))
 
-	// Enable pprof on Gorilla router by forwarding /debug/pprof/ to DefaultServeMux
-	r.PathPrefix("/debug/pprof/").Handler(http.DefaultServeMux)
+	// pprof, expvar and an always-on GraphiQL live on the internal admin listener
+	var adminSrv *http.Server
+	if cfg.Admin.Addr != "" {
+		playground := handler.New(&handler.Config{
+			Schema:   &librarySchema,
+			Pretty:   true,
+			GraphiQL: true,
+		})
+		ar := admin.NewRouter(graphqlChain(playground))
+		ar.Use(httpx.RequestMetadata(cfg.Server.TrustedProxies))
+		ar.Use(logging.Middleware)
+		adminSrv = &http.Server{
+			Addr:              cfg.Admin.Addr,
+			Handler:           ar,
+			ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+			IdleTimeout:       cfg.Server.IdleTimeout,
+			// No write timeout: CPU profiles and traces stream for as long as requested
+		}
+	}
 
-	// Port configuration
-	port := "8080"
-	if envPort := os.Getenv("PORT"); envPort != "" {
-		port = envPort
+	// CORS wraps the router: preflights carry no credentials and must be
+	// answered before AuthMiddleware and routes restricted to other methods
+	srv := &http.Server{
+		Addr:              ":" + strconv.Itoa(cfg.Server.Port),
+		Handler:           cors.New(cfg.CORS).Handler(r),
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+		MaxHeaderBytes:    cfg.Server.MaxHeaderBytes,
 	}
 
-	fmt.Printf("Server is running on port %s\n", port)
-	fmt.Printf("GraphiQL playground enabled at http://localhost:%s/graphql\n", port)
+	// SIGTERM from the orchestrator or Ctrl-C starts a graceful shutdown; a
+	// second signal kills the process
+	signals, stopSignals := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stopSignals()
 
-	if err := http.ListenAndServe(":"+port, r); err != nil {
-		log.Fatal("Failed to start server: ", err)
+	// Bind before reporting ready, so a port in use fails the start instead
+	// of a probe passing against a server that never listens
+	ln, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
+		fatal("failed to start server", err)
+	}
+	var adminLn net.Listener
+	if adminSrv != nil {
+		if adminLn, err = net.Listen("tcp", adminSrv.Addr); err != nil {
+			fatal("failed to start admin listener", err)
+		}
+	}
+
+	serveErr := make(chan error, 2)
+	go func() {
+		serveErr <- srv.Serve(ln)
+	}()
+	if adminSrv != nil {
+		go func() {
+			serveErr <- adminSrv.Serve(adminLn)
+		}()
+		slog.Info("admin listener is running", "addr", cfg.Admin.Addr, "graphiql", "http://"+cfg.Admin.Addr+"/graphql")
+	}
+	readiness.Set(true)
+	slog.Info("server is running", "port", cfg.Server.Port, "environment", cfg.Server.Environment, "graphiql", cfg.Server.GraphiQL, "introspection", cfg.Server.Introspection)
+
+	select {
+	case err := <-serveErr:
+		fatal("failed to start server", err)
+	case <-signals.Done():
+	}
+	stopSignals()
+
+	// Report not ready first so load balancers stop sending new requests, then
+	// let in-flight requests, including open borrow transactions, finish
+	slog.Info("shutting down, draining connections", "deadline", (cfg.Server.DrainDelay + cfg.Server.ShutdownTimeout).String())
+	readiness.Set(false)
+	time.Sleep(cfg.Server.DrainDelay)
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		slog.Warn("graceful shutdown incomplete, closing remaining connections", "error", err)
+		srv.Close()
+	}
+	if adminSrv != nil {
+		adminSrv.Close()
+	}
+
+	stopJobs()
+	runner.Wait()
+	if err := db.DB.Close(); err != nil {
+		slog.Error("failed to close database", "error", err)
+	}
+	if db.Replica != nil {
+		db.Replica.Close()
+	}
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelFlush()
+	if err := shutdownTracing(flushCtx); err != nil {
+		slog.Error("failed to flush traces", "error", err)
 	}
+	slog.Info("server stopped")
 }
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS borrow;
+DROP TABLE IF EXISTS books;
+DROP TABLE IF EXISTS members;
@@ -1,3 +1,4 @@
+-- Members, books and loans
 CREATE TABLE IF NOT EXISTS members (
     id SERIAL PRIMARY KEY,
     name VARCHAR(100) NOT NULL,
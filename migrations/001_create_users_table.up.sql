@@ -1,3 +1,4 @@
+-- Accounts for signed-in users
 CREATE TABLE IF NOT EXISTS users (
     id SERIAL PRIMARY KEY,
     google_id VARCHAR(255) UNIQUE NOT NULL,
@@ -0,0 +1,7 @@
+-- Accounts without a Google identity cannot be represented before this migration
+DROP INDEX IF EXISTS idx_users_provider_subject;
+DELETE FROM users WHERE google_id IS NULL;
+ALTER TABLE users ALTER COLUMN google_id SET NOT NULL;
+ALTER TABLE users DROP COLUMN IF EXISTS password_hash;
+ALTER TABLE users DROP COLUMN IF EXISTS subject;
+ALTER TABLE users DROP COLUMN IF EXISTS provider;
@@ -0,0 +1,12 @@
+-- Migration to support identity providers other than Google
+ALTER TABLE users ALTER COLUMN google_id DROP NOT NULL;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS provider VARCHAR(50) NOT NULL DEFAULT 'google';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS subject VARCHAR(255);
+ALTER TABLE users ADD COLUMN IF NOT EXISTS password_hash TEXT;
+
+-- Existing users all signed in with Google
+UPDATE users SET subject = google_id WHERE subject IS NULL;
+
+-- Users are found by the identity that created them, not by email
+ALTER TABLE users ALTER COLUMN subject SET NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_provider_subject ON users(provider, subject);
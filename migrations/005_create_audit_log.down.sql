@@ -0,0 +1,3 @@
+-- Dropping the table also drops its append-only triggers
+DROP TABLE IF EXISTS audit_log;
+DROP FUNCTION IF EXISTS audit_log_append_only();
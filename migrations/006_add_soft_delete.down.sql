@@ -0,0 +1,10 @@
+-- Soft-deleted rows become visible again
+DROP INDEX IF EXISTS idx_borrow_book_id;
+DROP INDEX IF EXISTS idx_borrow_member_id;
+DROP INDEX IF EXISTS idx_members_deleted_at;
+DROP INDEX IF EXISTS idx_books_deleted_at;
+
+ALTER TABLE members DROP COLUMN IF EXISTS deleted_by;
+ALTER TABLE members DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE books DROP COLUMN IF EXISTS deleted_by;
+ALTER TABLE books DROP COLUMN IF EXISTS deleted_at;
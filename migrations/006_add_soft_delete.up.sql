@@ -0,0 +1,12 @@
+-- Soft deletion for books and members: deleted rows keep their borrow history
+-- until the purge job removes them after the retention period
+ALTER TABLE books ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE books ADD COLUMN IF NOT EXISTS deleted_by INT; -- users.id, NULL when deleted by an API key
+
+ALTER TABLE members ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE members ADD COLUMN IF NOT EXISTS deleted_by INT;
+
+CREATE INDEX IF NOT EXISTS idx_books_deleted_at ON books(deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_members_deleted_at ON members(deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_borrow_member_id ON borrow(member_id);
+CREATE INDEX IF NOT EXISTS idx_borrow_book_id ON borrow(book_id);
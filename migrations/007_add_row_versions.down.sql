@@ -0,0 +1,2 @@
+ALTER TABLE members DROP COLUMN IF EXISTS version;
+ALTER TABLE books DROP COLUMN IF EXISTS version;
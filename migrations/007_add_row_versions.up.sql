@@ -0,0 +1,3 @@
+-- Row versions for optimistic concurrency control on book and member edits
+ALTER TABLE books ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1;
+ALTER TABLE members ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1;
@@ -0,0 +1,13 @@
+-- First response per idempotency key and principal, replayed to retries until expires_at
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    principal VARCHAR(100) NOT NULL, -- 'user:<id>' or 'apikey:<id>'
+    key VARCHAR(255) NOT NULL,
+    operation VARCHAR(64) NOT NULL,
+    request_hash CHAR(64) NOT NULL,  -- SHA-256 of the operation and its arguments
+    response JSONB,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (principal, key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_expires_at ON idempotency_keys(expires_at);
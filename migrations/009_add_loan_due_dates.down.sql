@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_borrow_due_date;
+ALTER TABLE borrow DROP COLUMN IF EXISTS renewals;
+ALTER TABLE borrow DROP COLUMN IF EXISTS due_date;
@@ -0,0 +1,10 @@
+-- Due dates and renewal counts for loans. due_date is compared with the
+-- application clock, so it carries a time zone.
+ALTER TABLE borrow ADD COLUMN IF NOT EXISTS due_date TIMESTAMPTZ;
+ALTER TABLE borrow ADD COLUMN IF NOT EXISTS renewals INT NOT NULL DEFAULT 0;
+
+-- Existing loans get the default 14 day loan period
+UPDATE borrow SET due_date = borrow_date::timestamptz + INTERVAL '14 days' WHERE due_date IS NULL;
+ALTER TABLE borrow ALTER COLUMN due_date SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_borrow_due_date ON borrow(due_date) WHERE status = 'borrowed';
@@ -0,0 +1,12 @@
+// Package migrations holds the versioned SQL schema, applied by pkg/migrate.
+// Each version has a NNN_name.up.sql file and a matching NNN_name.down.sql
+// that reverts it. Versions are applied in numeric order and must never be
+// edited once released; add a new version instead.
+package migrations
+
+import "embed"
+
+// FS contains the migration files
+//
+//go:embed *.sql
+var FS embed.FS
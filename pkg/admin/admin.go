@@ -0,0 +1,34 @@
+// Package admin serves the operator tools that must not face the internet:
+// pprof profiles, expvar counters and the GraphiQL playground. Bind it to a
+// loopback or cluster-internal address, separate from the public API.
+package admin
+
+import (
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+
+	"github.com/gorilla/mux"
+)
+
+// Config selects where the admin listener runs
+type Config struct {
+	Addr string // host:port; empty disables the listener
+}
+
+// NewRouter returns the admin routes. graphiql serves the playground and
+// should carry the same authentication as the public GraphQL endpoint.
+func NewRouter(graphiql http.Handler) *mux.Router {
+	r := mux.NewRouter()
+
+	r.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	r.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	r.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	r.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	// Index also serves the named profiles, e.g. /debug/pprof/heap
+	r.PathPrefix("/debug/pprof/").HandlerFunc(pprof.Index)
+
+	r.Handle("/debug/vars", expvar.Handler()).Methods(http.MethodGet)
+	r.Handle("/graphql", graphiql)
+	return r
+}
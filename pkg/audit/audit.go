@@ -0,0 +1,98 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"library-system/pkg/auth"
+	"library-system/pkg/httpx"
+	"library-system/pkg/repository"
+)
+
+// Entry is one immutable audit log record
+type Entry = repository.AuditEntry
+
+// Filter narrows an audit log query. Zero values match everything.
+type Filter = repository.AuditFilter
+
+// Record appends an audit entry for action on an entity to log. Pass the
+// audit log of the mutation's transaction so the entry commits or rolls back
+// with the change it describes. The actor, request ID and client IP are taken
+// from ctx; before and after are stored as JSON.
+func Record(ctx context.Context, log repository.AuditLog, action, entityType string, entityID interface{}, before, after interface{}) error {
+	beforeJSON, err := snapshot(before)
+	if err != nil {
+		return err
+	}
+	afterJSON, err := snapshot(after)
+	if err != nil {
+		return err
+	}
+
+	rec := repository.AuditRecord{
+		Actor:      "system",
+		Action:     action,
+		EntityType: entityType,
+		EntityID:   fmt.Sprint(entityID),
+		Before:     beforeJSON,
+		After:      afterJSON,
+		RequestID:  httpx.RequestIDFrom(ctx),
+		IP:         httpx.ClientIPFrom(ctx),
+	}
+	if p, ok := auth.PrincipalFrom(ctx); ok {
+		if p.IsUser() {
+			rec.Actor = "user:" + strconv.Itoa(p.UserID)
+			userID := p.UserID
+			rec.ActorUserID = &userID
+		} else {
+			rec.Actor = "apikey:" + p.TokenID
+			if id, err := strconv.Atoi(p.TokenID); err == nil {
+				rec.ActorAPIKeyID = &id
+			}
+		}
+	}
+
+	if err := log.Append(ctx, rec); err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	return nil
+}
+
+func snapshot(v interface{}) (*string, error) {
+	if v == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode audit snapshot: %w", err)
+	}
+	s := string(b)
+	return &s, nil
+}
+
+// MaxPageSize caps the number of entries returned by one List call
+const MaxPageSize = 500
+
+// List returns up to limit entries of log matching f, newest first, starting
+// after the entry with ID afterID (0 for the first page). The second value is
+// the cursor for the next page, or 0 when there are no more entries.
+func List(ctx context.Context, log repository.AuditLog, f Filter, limit int, afterID int64) ([]Entry, int64, error) {
+	if limit <= 0 || limit > MaxPageSize {
+		limit = MaxPageSize
+	}
+
+	// Fetch one extra entry to know whether another page exists
+	entries, err := log.List(ctx, f, afterID, limit+1)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var next int64
+	if len(entries) > limit {
+		entries = entries[:limit]
+		next = entries[limit-1].ID
+	}
+	return entries, next, nil
+}
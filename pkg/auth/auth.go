@@ -2,179 +2,373 @@ package auth
 
 import (
 	"context"
-	"crypto/rand"
-	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
-	"os"
+	"strconv"
 	"strings"
 	"time"
 
-	"library-system/pkg/db"
+	"library-system/pkg/logging"
 	"library-system/pkg/models"
+	"library-system/pkg/repository"
 
 	"github.com/golang-jwt/jwt/v5"
-	"golang.org/x/oauth2"
-	"golang.org/x/oauth2/google"
 )
 
 var (
-	googleOauthConfig *oauth2.Config
-	jwtSecret         []byte
+	jwtSecret  []byte
+	httpClient = &http.Client{Timeout: 10 * time.Second}
+
+	// baseURL is the externally visible address of this server, used to build provider callback URLs
+	baseURL string
+	// cookieSecure marks auth cookies as HTTPS-only
+	cookieSecure bool
+	// sessionSameSite is the SameSite attribute of the session cookie
+	sessionSameSite = http.SameSiteLaxMode
+	// redirectAllowlist holds the origins (scheme://host[:port]) allowed as absolute post-login redirect targets
+	redirectAllowlist []string
+	// users stores the accounts that logins are provisioned into
+	users repository.UserRepository
+	// apiKeys stores the keys machine clients authenticate with
+	apiKeys repository.APIKeyRepository
 )
 
-func InitAuth() {
-	jwtSecret = []byte(os.Getenv("JWT_SECRET"))
-	if len(jwtSecret) == 0 {
-		log.Fatal("JWT_SECRET is not set")
-	}
+// Config configures InitAuth; see package config for where the values come from
+type Config struct {
+	JWTSecret         string
+	BaseURL           string   // Externally visible address of this server, without a trailing slash
+	CookieSecure      bool     // Mark auth cookies as HTTPS-only
+	CookieSameSite    string   // SameSite of the session cookie: SameSiteLax, SameSiteStrict or SameSiteNone
+	RedirectAllowlist []string // Origins allowed as absolute post-login redirect targets
+	Google            GoogleConfig
+	OIDC              OIDCConfig
+	Local             LocalConfig
+}
 
-	googleOauthConfig = &oauth2.Config{
-		RedirectURL:  "http://localhost:8082/auth/google/callback",
-		ClientID:     os.Getenv("GOOGLE_CLIENT_ID"),
-		ClientSecret: os.Getenv("GOOGLE_CLIENT_SECRET"),
-		Scopes:       []string{"https://www.googleapis.com/auth/userinfo.email", "https://www.googleapis.com/auth/userinfo.profile"},
-		Endpoint:     google.Endpoint,
-	}
+// GoogleConfig enables Google sign-in when ClientID is set
+type GoogleConfig struct {
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string // Defaults to the callback under BaseURL
 }
 
-func GenerateStateOauthCookie(w http.ResponseWriter) string {
-	var expiration = time.Now().Add(20 * time.Minute)
-	b := make([]byte, 16)
-	rand.Read(b)
-	state := base64.URLEncoding.EncodeToString(b)
-	cookie := http.Cookie{Name: "oauthstate", Value: state, Expires: expiration, HttpOnly: true}
-	http.SetCookie(w, &cookie)
-	return state
+// OIDCConfig enables a generic OpenID Connect provider, e.g. Keycloak, Azure AD or Okta, when IssuerURL is set
+type OIDCConfig struct {
+	ProviderName string
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string // Defaults to the callback under BaseURL
+	Scopes       []string
 }
 
-func GoogleLoginHandler(w http.ResponseWriter, r *http.Request) {
-	oauthState := GenerateStateOauthCookie(w)
-	u := googleOauthConfig.AuthCodeURL(oauthState, oauth2.AccessTypeOffline, oauth2.SetAuthURLParam("prompt", "select_account"))
-	http.Redirect(w, r, u, http.StatusTemporaryRedirect)
+// LocalConfig enables email/password accounts
+type LocalConfig struct {
+	Enabled               bool
+	PasswordHashAlgorithm string // HashArgon2id or HashBcrypt
 }
 
-func GoogleCallbackHandler(w http.ResponseWriter, r *http.Request) {
-	oauthState, err := r.Cookie("oauthstate")
-	if err != nil {
-		log.Println("oauth state cookie missing")
-		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
-		return
+// SameSite attributes for the session cookie
+const (
+	SameSiteLax    = "lax"
+	SameSiteStrict = "strict"
+	SameSiteNone   = "none" // Requires Secure; for front-ends on another site
+)
+
+var sameSiteModes = map[string]http.SameSite{
+	SameSiteLax:    http.SameSiteLaxMode,
+	SameSiteStrict: http.SameSiteStrictMode,
+	SameSiteNone:   http.SameSiteNoneMode,
+}
+
+// InitAuth configures signing, cookies and the enabled identity providers
+func InitAuth(userRepo repository.UserRepository, keyRepo repository.APIKeyRepository, cfg Config) error {
+	users = userRepo
+	apiKeys = keyRepo
+	jwtSecret = []byte(cfg.JWTSecret)
+	baseURL = cfg.BaseURL
+	cookieSecure = cfg.CookieSecure
+	if cfg.CookieSameSite != "" {
+		mode, ok := sameSiteModes[cfg.CookieSameSite]
+		if !ok {
+			return fmt.Errorf("unknown cookie SameSite mode %q", cfg.CookieSameSite)
+		}
+		if mode == http.SameSiteNoneMode && !cfg.CookieSecure {
+			// Browsers drop SameSite=None cookies without Secure
+			return errors.New("SameSite=None cookies must be Secure")
+		}
+		sessionSameSite = mode
 	}
+	redirectAllowlist = cfg.RedirectAllowlist
 
-	if r.FormValue("state") != oauthState.Value {
-		log.Println("invalid oauth google state")
-		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
-		return
+	if cfg.Google.ClientID != "" {
+		redirectURL := cfg.Google.RedirectURL
+		if redirectURL == "" {
+			redirectURL = callbackURL("google")
+		}
+		RegisterProvider(NewGoogleProvider(cfg.Google.ClientID, cfg.Google.ClientSecret, redirectURL))
 	}
 
-	code := r.FormValue("code")
-	token, err := googleOauthConfig.Exchange(context.Background(), code)
-	if err != nil {
-		log.Printf("code exchange failed: %s\n", err.Error())
-		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
-		return
+	if oidc := cfg.OIDC; oidc.IssuerURL != "" {
+		redirectURL := oidc.RedirectURL
+		if redirectURL == "" {
+			redirectURL = callbackURL(oidc.ProviderName)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+		p, err := NewOIDCProvider(ctx, oidc.ProviderName, oidc.IssuerURL, oidc.ClientID, oidc.ClientSecret, redirectURL, oidc.Scopes)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("configure OIDC provider %q: %w", oidc.ProviderName, err)
+		}
+		RegisterProvider(p)
 	}
 
-	response, err := http.Get("https://www.googleapis.com/oauth2/v2/userinfo?access_token=" + token.AccessToken)
-	if err != nil {
-		log.Printf("failed getting user info: %s\n", err.Error())
-		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
-		return
+	// Local email/password accounts for clients that cannot use an external provider
+	if cfg.Local.Enabled {
+		p, err := NewLocalProvider(cfg.Local.PasswordHashAlgorithm, users)
+		if err != nil {
+			return fmt.Errorf("configure local accounts: %w", err)
+		}
+		RegisterProvider(p)
 	}
-	defer response.Body.Close()
+	return nil
+}
 
-	contents, err := io.ReadAll(response.Body)
-	if err != nil {
-		log.Printf("failed reading response body: %s\n", err.Error())
-		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+// callbackURL returns the OAuth redirect URL for the named provider
+func callbackURL(provider string) string {
+	return baseURL + "/auth/" + provider + "/callback"
+}
+
+// LoginHandler redirects the browser to the provider's consent screen.
+// An optional redirect_to parameter selects where the browser lands after a successful login.
+func LoginHandler(p RedirectProvider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		redirectTo := r.URL.Query().Get("redirect_to")
+		if !validRedirectTarget(redirectTo) {
+			renderAuthError(w, r, http.StatusBadRequest, ReasonInvalidRedirect, "", fmt.Errorf("rejected redirect_to %q", redirectTo))
+			return
+		}
+
+		flow := newLoginFlow()
+		if err := setFlowCookie(w, p.Name(), flow, redirectTo); err != nil {
+			renderAuthError(w, r, http.StatusInternalServerError, ReasonInternal, "", err)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		http.Redirect(w, r, p.AuthCodeURL(flow), http.StatusFound)
+	}
+}
+
+// CallbackHandler completes the redirect flow and issues a session for the provider's user.
+// The state is single-use, the PKCE verifier is sent with the code exchange, and the
+// ID token nonce is checked by the provider.
+func CallbackHandler(p RedirectProvider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		retryURL := "/auth/" + p.Name() + "/login"
+
+		claims, err := consumeFlow(r, p.Name())
+		// The cookie is cleared whatever the outcome
+		clearFlowCookie(w)
+		if err != nil {
+			reason := ReasonStateInvalid
+			switch {
+			case errors.Is(err, errFlowMissing):
+				reason = ReasonStateMissing
+			case errors.Is(err, errFlowMismatch):
+				reason = ReasonStateMismatch
+			case errors.Is(err, errFlowReused):
+				reason = ReasonStateReused
+			}
+			renderAuthError(w, r, http.StatusBadRequest, reason, retryURL, err)
+			return
+		}
+
+		if providerErr := r.FormValue("error"); providerErr != "" {
+			renderAuthError(w, r, http.StatusUnauthorized, ReasonProviderError, retryURL,
+				fmt.Errorf("%s returned %s: %s", p.Name(), providerErr, r.FormValue("error_description")))
+			return
+		}
+
+		code := r.FormValue("code")
+		if code == "" {
+			renderAuthError(w, r, http.StatusBadRequest, ReasonMissingCode, retryURL, nil)
+			return
+		}
+
+		flow := LoginFlow{State: claims.State, Nonce: claims.Nonce, CodeVerifier: claims.CodeVerifier}
+		identity, err := p.Exchange(r.Context(), code, flow)
+		if err != nil {
+			renderAuthError(w, r, http.StatusUnauthorized, ReasonExchangeFailed, retryURL, fmt.Errorf("%s login failed: %w", p.Name(), err))
+			return
+		}
+
+		completeLogin(w, r, identity, claims.RedirectTo)
+	}
+}
+
+// LocalLoginHandler signs in a local account with an email and password.
+// It accepts either a JSON body or a form post.
+func LocalLoginHandler(w http.ResponseWriter, r *http.Request) {
+	p, ok := GetProvider("local")
+	local, isPassword := p.(PasswordProvider)
+	if !ok || !isPassword {
+		http.NotFound(w, r)
 		return
 	}
 
-	var googleUser struct {
-		ID      string `json:"id"`
-		Email   string `json:"email"`
-		Name    string `json:"name"`
-		Picture string `json:"picture"`
+	var creds struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		if err := json.NewDecoder(io.LimitReader(r.Body, 1<<16)).Decode(&creds); err != nil {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+	} else {
+		creds.Email = r.FormValue("email")
+		creds.Password = r.FormValue("password")
 	}
 
-	if err := json.Unmarshal(contents, &googleUser); err != nil {
-		log.Printf("failed unmarshalling user info: %s\n", err.Error())
-		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+	identity, err := local.Authenticate(r.Context(), strings.TrimSpace(creds.Email), creds.Password)
+	if errors.Is(err, ErrInvalidCredentials) {
+		http.Error(w, "Unauthorized: Invalid email or password", http.StatusUnauthorized)
 		return
 	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "local login failed", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	completeLogin(w, r, identity, "")
+}
 
+// completeLogin provisions the user for identity and issues a session token.
+// The browser is sent to redirectTo if set, otherwise the token is returned as JSON.
+func completeLogin(w http.ResponseWriter, r *http.Request, identity *Identity, redirectTo string) {
 	// Create or Update User in DB
 	user := models.User{
-		GoogleID:  googleUser.ID,
-		Email:     googleUser.Email,
-		Name:      googleUser.Name,
-		AvatarURL: googleUser.Picture,
+		Provider:  identity.Provider,
+		Subject:   identity.Subject,
+		Email:     identity.Email,
+		Name:      identity.Name,
+		AvatarURL: identity.Picture,
+	}
+	if identity.Provider == "google" {
+		user.GoogleID = identity.Subject
 	}
 
-	err = upsertUser(&user)
+	user, err := users.UpsertIdentity(r.Context(), user)
+	if errors.Is(err, repository.ErrIdentityConflict) {
+		renderAuthError(w, r, http.StatusConflict, ReasonIdentityConflict, "", fmt.Errorf("%s login for %s: %w", identity.Provider, identity.Email, err))
+		return
+	}
 	if err != nil {
-		log.Printf("failed to upsert user: %v\n", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		renderAuthError(w, r, http.StatusInternalServerError, ReasonProvisioningFailed, "", fmt.Errorf("failed to upsert user: %w", err))
 		return
 	}
 
 	// Generate JWT
-	sessionToken, err := GenerateJWT(user)
+	sessionToken, sessionID, err := issueSessionToken(user)
 	if err != nil {
-		log.Printf("failed to generate token: %v\n", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		renderAuthError(w, r, http.StatusInternalServerError, ReasonInternal, "", fmt.Errorf("failed to generate token: %w", err))
 		return
 	}
 
 	// Set Token in Cookie or Response
 	// Using a cookie for simplicity in browser
-	// Set Token in Cookie or Response
 	http.SetCookie(w, &http.Cookie{
 		Name:     "session_token",
 		Value:    sessionToken,
 		Expires:  time.Now().Add(24 * time.Hour), // Match the 24h expiration
 		HttpOnly: true,
+		Secure:   cookieSecure,
+		SameSite: sessionSameSite,
 		Path:     "/",
 	})
+	setCSRFCookie(w, sessionID)
+
+	w.Header().Set("Cache-Control", "no-store")
+	if redirectTo != "" {
+		http.Redirect(w, r, redirectTo, http.StatusSeeOther)
+		return
+	}
 
 	// Also return it in body for convenience if testing via API
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"token": sessionToken, "message": "Login successful"})
 }
 
-func upsertUser(user *models.User) error {
-	query := `
-		INSERT INTO users (google_id, email, name, avatar_url, role)
-		VALUES ($1, $2, $3, $4, 'MEMBER')
-		ON CONFLICT (email) DO UPDATE 
-		SET name = EXCLUDED.name, avatar_url = EXCLUDED.avatar_url, google_id = EXCLUDED.google_id
-		RETURNING id, role`
-
-	err := db.DB.QueryRow(query, user.GoogleID, user.Email, user.Name, user.AvatarURL).Scan(&user.ID, &user.Role)
-	return err
+// sessionClaims are the claims of a session token
+type sessionClaims struct {
+	jwt.RegisteredClaims
+	UserID   int    `json:"user_id"`
+	MemberID int    `json:"member_id,omitempty"`
+	Email    string `json:"email"`
+	Role     string `json:"role"`
 }
 
 func GenerateJWT(user models.User) (string, error) {
-	claims := jwt.MapClaims{
-		"user_id": user.ID,
-		"email":   user.Email,
-		"role":    user.Role,
-		"exp":     time.Now().Add(24 * time.Hour).Unix(),
+	token, _, err := issueSessionToken(user)
+	return token, err
+}
+
+// issueSessionToken signs a session token for user and returns it with its token id
+func issueSessionToken(user models.User) (string, string, error) {
+	claims := sessionClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        randomToken(),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
+		},
+		UserID: user.ID,
+		Email:  user.Email,
+		Role:   user.Role,
+	}
+	if user.MemberID != nil {
+		claims.MemberID = *user.MemberID
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtSecret)
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(jwtSecret)
+	return token, claims.ID, err
 }
 
 func AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Service accounts authenticate with an API key instead of a session
+		if apiKey := apiKeyFromRequest(r); apiKey != "" {
+			key, err := authenticateAPIKey(r.Context(), apiKey)
+			if errors.Is(err, ErrInvalidAPIKey) {
+				http.Error(w, "Unauthorized: Invalid, revoked or expired API key", http.StatusUnauthorized)
+				return
+			}
+			if err != nil {
+				slog.ErrorContext(r.Context(), "api key lookup failed", "error", err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+
+			// API keys carry no user or role, only the permissions they were created with
+			p := &Principal{
+				Permissions: key.Permissions,
+				AuthMethod:  AuthMethodAPIKey,
+				TokenID:     strconv.Itoa(key.ID),
+			}
+			logging.Annotate(r.Context(), slog.Any("principal", p))
+			ctx := WithPrincipal(r.Context(), p)
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
 		// Check cookie first
 		cookie, err := r.Cookie("session_token")
 		var tokenString string
+		method := AuthMethodSessionCookie
 		if err == nil {
 			tokenString = cookie.Value
 		} else {
@@ -182,6 +376,7 @@ func AuthMiddleware(next http.Handler) http.Handler {
 			authHeader := r.Header.Get("Authorization")
 			if strings.HasPrefix(authHeader, "Bearer ") {
 				tokenString = strings.TrimPrefix(authHeader, "Bearer ")
+				method = AuthMethodBearer
 			}
 		}
 
@@ -190,7 +385,8 @@ func AuthMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		claims := &sessionClaims{}
+		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
 			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 			}
@@ -202,15 +398,22 @@ func AuthMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
+		if claims.UserID == 0 {
 			http.Error(w, "Unauthorized: Invalid claims", http.StatusUnauthorized)
 			return
 		}
 
-		// Inject user_id and role into context
-		ctx := context.WithValue(r.Context(), "user_id", claims["user_id"])
-		ctx = context.WithValue(ctx, "role", claims["role"])
+		// Inject the principal into context
+		p := &Principal{
+			UserID:      claims.UserID,
+			MemberID:    claims.MemberID,
+			Role:        claims.Role,
+			Permissions: PermissionsForRole(claims.Role),
+			AuthMethod:  method,
+			TokenID:     claims.ID,
+		}
+		logging.Annotate(r.Context(), slog.Any("principal", p))
+		ctx := WithPrincipal(r.Context(), p)
 
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
@@ -218,20 +421,13 @@ func AuthMiddleware(next http.Handler) http.Handler {
 
 // MeHandler returns the current user's info based on the session token
 func MeHandler(w http.ResponseWriter, r *http.Request) {
-	userId, ok := r.Context().Value("user_id").(float64)
-	if !ok {
-		// Try int if it's from internal context
-		idInt, okInt := r.Context().Value("user_id").(int)
-		if !okInt {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
-		}
-		userId = float64(idInt)
+	principal, ok := PrincipalFrom(r.Context())
+	if !ok || !principal.IsUser() {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
 	}
 
-	var user models.User
-	err := db.DB.QueryRow("SELECT id, email, name, avatar_url, role FROM users WHERE id = $1", int(userId)).
-		Scan(&user.ID, &user.Email, &user.Name, &user.AvatarURL, &user.Role)
+	user, err := users.Get(r.Context(), principal.UserID)
 	if err != nil {
 		http.Error(w, "User not found", http.StatusNotFound)
 		return
@@ -241,11 +437,10 @@ func MeHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(user)
 }
 
-// GetRoleFromContext retrieves the user role from context
-func GetRoleFromContext(ctx context.Context) string {
-	role, ok := ctx.Value("role").(string)
-	if !ok {
-		return ""
+// Check reports whether InitAuth has configured a signing key and the stores
+func Check() error {
+	if len(jwtSecret) == 0 || users == nil || apiKeys == nil {
+		return errors.New("auth is not initialized")
 	}
-	return role
+	return nil
 }
@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"time"
+
+	"library-system/pkg/gqlrequest"
+)
+
+const (
+	// CSRFCookieName is readable by JavaScript so browser clients can echo it in CSRFHeaderName
+	CSRFCookieName = "csrf_token"
+	CSRFHeaderName = "X-CSRF-Token"
+)
+
+// csrfToken derives the CSRF token for a session from its token id, so a token
+// planted by another site or subdomain never matches a victim's session
+func csrfToken(sessionID string) string {
+	mac := hmac.New(sha256.New, jwtSecret)
+	mac.Write([]byte("csrf:" + sessionID))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func setCSRFCookie(w http.ResponseWriter, sessionID string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     CSRFCookieName,
+		Value:    csrfToken(sessionID),
+		Expires:  time.Now().Add(24 * time.Hour), // Match the session cookie
+		Path:     "/",
+		Secure:   cookieSecure,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// CSRFTokenHandler returns the CSRF token for the current cookie session and
+// (re)sets the csrf_token cookie. It must be wrapped by AuthMiddleware.
+func CSRFTokenHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := PrincipalFrom(r.Context())
+	if !ok || principal.AuthMethod != AuthMethodSessionCookie {
+		http.Error(w, "CSRF tokens are only used with cookie sessions", http.StatusBadRequest)
+		return
+	}
+
+	setCSRFCookie(w, principal.TokenID)
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"csrf_token": csrfToken(principal.TokenID)})
+}
+
+// CSRFMiddleware protects GraphQL requests authenticated by the session cookie:
+//   - bodies must be JSON or application/graphql, so no HTML form can submit them
+//   - mutations are rejected over GET
+//   - mutations must carry the session's token in the X-CSRF-Token header
+//
+// Bearer and API key clients are not exposed to CSRF and are passed through.
+// It must be wrapped by AuthMiddleware.
+func CSRFMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := PrincipalFrom(r.Context())
+		if !ok || principal.AuthMethod != AuthMethodSessionCookie {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		safeMethod := r.Method == http.MethodGet || r.Method == http.MethodHead
+		if !safeMethod {
+			mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+			if mediaType != "application/json" && mediaType != "application/graphql" {
+				http.Error(w, "Unsupported Media Type: cookie-authenticated requests must use application/json", http.StatusUnsupportedMediaType)
+				return
+			}
+		}
+
+		req, err := gqlrequest.From(r)
+		if err != nil {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		if !req.IsMutation() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if safeMethod {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "Method Not Allowed: mutations must use POST", http.StatusMethodNotAllowed)
+			return
+		}
+
+		expected := csrfToken(principal.TokenID)
+		if !hmac.Equal([]byte(r.Header.Get(CSRFHeaderName)), []byte(expected)) {
+			http.Error(w, "Forbidden: missing or invalid "+CSRFHeaderName+" header", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"encoding/json"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// Reason codes reported to the user when a login fails
+const (
+	ReasonUnknownProvider    = "unknown_provider"
+	ReasonInvalidRedirect    = "invalid_redirect"
+	ReasonStateMissing       = "state_missing"
+	ReasonStateInvalid       = "state_invalid"
+	ReasonStateMismatch      = "state_mismatch"
+	ReasonStateReused        = "state_reused"
+	ReasonProviderError      = "provider_error"
+	ReasonMissingCode        = "missing_code"
+	ReasonExchangeFailed     = "exchange_failed"
+	ReasonProvisioningFailed = "provisioning_failed"
+	ReasonIdentityConflict   = "identity_conflict"
+	ReasonInternal           = "internal_error"
+)
+
+var reasonMessages = map[string]string{
+	ReasonUnknownProvider:    "This sign-in method is not available.",
+	ReasonInvalidRedirect:    "The page you asked to return to is not allowed.",
+	ReasonStateMissing:       "Your sign-in session was not found. Cookies may be blocked, or the sign-in took too long.",
+	ReasonStateInvalid:       "Your sign-in session has expired.",
+	ReasonStateMismatch:      "The sign-in response did not match your session.",
+	ReasonStateReused:        "This sign-in link has already been used.",
+	ReasonProviderError:      "The identity provider reported an error.",
+	ReasonMissingCode:        "The identity provider did not return an authorization code.",
+	ReasonExchangeFailed:     "We could not verify your identity with the provider.",
+	ReasonProvisioningFailed: "Your account could not be set up.",
+	ReasonIdentityConflict:   "An account with this email already exists. Sign in the way you signed in before.",
+	ReasonInternal:           "Something went wrong on our side.",
+}
+
+var errorPageTemplate = template.Must(template.New("auth-error").Parse(`<!DOCTYPE html>
+<html>
+<head>
+  <meta charset="utf-8" />
+  <title>Sign-in failed</title>
+  <meta name="robots" content="noindex" />
+</head>
+<body>
+  <h1>Sign-in failed</h1>
+  <p>{{ .Message }}</p>
+  <p>Reason code: <code>{{ .Code }}</code></p>
+  {{ if .RetryURL }}<p><a href="{{ .RetryURL }}">Try again</a></p>{{ end }}
+</body>
+</html>
+`))
+
+// renderAuthError responds with a user-visible error page (or JSON for API clients)
+// carrying a stable reason code. Internal details are only logged.
+func renderAuthError(w http.ResponseWriter, r *http.Request, status int, code, retryURL string, cause error) {
+	if cause != nil {
+		slog.WarnContext(r.Context(), "auth error", "code", code, "path", r.URL.Path, "error", cause)
+	}
+
+	message, ok := reasonMessages[code]
+	if !ok {
+		message = reasonMessages[ReasonInternal]
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	if strings.Contains(r.Header.Get("Accept"), "application/json") {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]string{"error": code, "message": message})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	errorPageTemplate.Execute(w, struct {
+		Code     string
+		Message  string
+		RetryURL string
+	}{code, message, retryURL})
+}
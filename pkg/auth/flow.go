@@ -0,0 +1,187 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/oauth2"
+)
+
+// LoginFlow carries the per-login secrets that bind a callback to the browser that started it
+type LoginFlow struct {
+	State        string
+	Nonce        string
+	CodeVerifier string // PKCE (RFC 7636) verifier, sent to the provider as an S256 challenge
+}
+
+const (
+	stateCookieName = "oauthstate"
+	stateCookiePath = "/auth/"
+	loginFlowTTL    = 10 * time.Minute
+)
+
+// flowClaims is the signed payload of the state cookie
+type flowClaims struct {
+	jwt.RegisteredClaims
+	Provider     string `json:"prv"`
+	State        string `json:"st"`
+	Nonce        string `json:"nc"`
+	CodeVerifier string `json:"cv"`
+	RedirectTo   string `json:"rt,omitempty"`
+}
+
+// newLoginFlow generates fresh state, nonce and PKCE verifier values
+func newLoginFlow() LoginFlow {
+	return LoginFlow{
+		State:        randomToken(),
+		Nonce:        randomToken(),
+		CodeVerifier: oauth2.GenerateVerifier(),
+	}
+}
+
+func randomToken() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// setFlowCookie stores the login flow in a signed, short-lived cookie scoped to the auth routes
+func setFlowCookie(w http.ResponseWriter, provider string, flow LoginFlow, redirectTo string) error {
+	now := time.Now()
+	claims := flowClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        flow.State,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(loginFlowTTL)),
+		},
+		Provider:     provider,
+		State:        flow.State,
+		Nonce:        flow.Nonce,
+		CodeVerifier: flow.CodeVerifier,
+		RedirectTo:   redirectTo,
+	}
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(jwtSecret)
+	if err != nil {
+		return err
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     stateCookieName,
+		Value:    signed,
+		Path:     stateCookiePath,
+		MaxAge:   int(loginFlowTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   cookieSecure,
+		// Lax is required: the callback is a top-level navigation coming from the provider
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+// clearFlowCookie removes the state cookie so it cannot be replayed by the browser
+func clearFlowCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     stateCookieName,
+		Value:    "",
+		Path:     stateCookiePath,
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   cookieSecure,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+var (
+	errFlowMissing  = errors.New("state cookie missing")
+	errFlowInvalid  = errors.New("state cookie invalid or expired")
+	errFlowMismatch = errors.New("state parameter does not match")
+	errFlowReused   = errors.New("state has already been used")
+)
+
+// consumeFlow validates the callback's state against the state cookie and marks it as used.
+// A state is accepted at most once.
+func consumeFlow(r *http.Request, provider string) (*flowClaims, error) {
+	cookie, err := r.Cookie(stateCookieName)
+	if err != nil {
+		return nil, errFlowMissing
+	}
+
+	claims := &flowClaims{}
+	_, err = jwt.ParseWithClaims(cookie.Value, claims, func(token *jwt.Token) (interface{}, error) {
+		return jwtSecret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Name}), jwt.WithExpirationRequired())
+	if err != nil || claims.Provider != provider {
+		return nil, errFlowInvalid
+	}
+
+	if subtle.ConstantTimeCompare([]byte(r.FormValue("state")), []byte(claims.State)) != 1 {
+		return nil, errFlowMismatch
+	}
+
+	if !usedStates.markUsed(claims.State, claims.ExpiresAt.Time) {
+		return nil, errFlowReused
+	}
+	return claims, nil
+}
+
+// stateLedger remembers consumed states until they expire, so a captured
+// callback URL and cookie cannot be replayed against this instance
+type stateLedger struct {
+	mu   sync.Mutex
+	used map[string]time.Time
+}
+
+var usedStates = &stateLedger{used: map[string]time.Time{}}
+
+// markUsed records state and reports whether it had not been used before
+func (l *stateLedger) markUsed(state string, expires time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	for s, exp := range l.used {
+		if now.After(exp) {
+			delete(l.used, s)
+		}
+	}
+
+	if _, seen := l.used[state]; seen {
+		return false
+	}
+	l.used[state] = expires
+	return true
+}
+
+// validRedirectTarget reports whether target may be used as a post-login redirect.
+// Same-site relative paths are always allowed; absolute URLs must match an allow-listed origin.
+func validRedirectTarget(target string) bool {
+	if target == "" {
+		return true
+	}
+	if strings.ContainsAny(target, "\\\r\n") {
+		return false
+	}
+	if strings.HasPrefix(target, "/") && !strings.HasPrefix(target, "//") {
+		return true
+	}
+
+	u, err := url.Parse(target)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" || u.User != nil {
+		return false
+	}
+	origin := u.Scheme + "://" + u.Host
+	for _, allowed := range redirectAllowlist {
+		if strings.EqualFold(origin, allowed) {
+			return true
+		}
+	}
+	return false
+}
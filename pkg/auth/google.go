@@ -0,0 +1,117 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+const (
+	googleUserInfoURL = "https://www.googleapis.com/oauth2/v2/userinfo"
+	googleJWKSURL     = "https://www.googleapis.com/oauth2/v3/certs"
+)
+
+// GoogleProvider signs users in with their Google account
+type GoogleProvider struct {
+	config   *oauth2.Config
+	verifier *idTokenVerifier
+}
+
+// NewGoogleProvider creates a Google provider for the given OAuth client
+func NewGoogleProvider(clientID, clientSecret, redirectURL string) *GoogleProvider {
+	return &GoogleProvider{
+		config: &oauth2.Config{
+			RedirectURL:  redirectURL,
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			Scopes:       []string{"openid", "https://www.googleapis.com/auth/userinfo.email", "https://www.googleapis.com/auth/userinfo.profile"},
+			Endpoint:     google.Endpoint,
+		},
+		verifier: newIDTokenVerifier([]string{"https://accounts.google.com", "accounts.google.com"}, clientID, googleJWKSURL),
+	}
+}
+
+func (g *GoogleProvider) Name() string { return "google" }
+
+func (g *GoogleProvider) AuthCodeURL(flow LoginFlow) string {
+	return g.config.AuthCodeURL(flow.State,
+		oauth2.AccessTypeOffline,
+		oauth2.SetAuthURLParam("prompt", "select_account"),
+		oauth2.SetAuthURLParam("nonce", flow.Nonce),
+		oauth2.S256ChallengeOption(flow.CodeVerifier),
+	)
+}
+
+func (g *GoogleProvider) Exchange(ctx context.Context, code string, flow LoginFlow) (*Identity, error) {
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, httpClient)
+	token, err := g.config.Exchange(ctx, code, oauth2.VerifierOption(flow.CodeVerifier))
+	if err != nil {
+		return nil, fmt.Errorf("code exchange failed: %w", err)
+	}
+
+	// The ID token binds this response to the login flow through its nonce
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		return nil, errors.New("token response did not contain an id_token")
+	}
+	claims, err := g.verifier.Verify(ctx, rawIDToken, flow.Nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	var googleUser struct {
+		ID      string `json:"id"`
+		Email   string `json:"email"`
+		Name    string `json:"name"`
+		Picture string `json:"picture"`
+		// VerifiedEmail is false for addresses Google has not confirmed
+		VerifiedEmail bool `json:"verified_email"`
+	}
+	if err := fetchJSON(ctx, googleUserInfoURL, token.AccessToken, &googleUser); err != nil {
+		return nil, fmt.Errorf("failed getting user info: %w", err)
+	}
+
+	if googleUser.ID != claims.Subject {
+		return nil, errors.New("user info does not match the id_token subject")
+	}
+	if !googleUser.VerifiedEmail {
+		return nil, errors.New("email address is not verified by Google")
+	}
+
+	return &Identity{
+		Provider: g.Name(),
+		Subject:  googleUser.ID,
+		Email:    googleUser.Email,
+		Name:     googleUser.Name,
+		Picture:  googleUser.Picture,
+	}, nil
+}
+
+// fetchJSON performs a GET request and decodes the JSON response into v.
+// If accessToken is set it is sent as a Bearer token.
+func fetchJSON(ctx context.Context, url, accessToken string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: unexpected status %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
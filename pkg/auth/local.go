@@ -0,0 +1,156 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"library-system/pkg/repository"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Supported password hashing algorithms
+const (
+	HashArgon2id = "argon2id"
+	HashBcrypt   = "bcrypt"
+)
+
+// MinPasswordLength is the shortest password accepted for a local account
+const MinPasswordLength = 10
+
+// argon2id parameters, following the OWASP recommendation for interactive logins
+const (
+	argonTime    = 2
+	argonMemory  = 19 * 1024
+	argonThreads = 1
+	argonKeyLen  = 32
+	argonSaltLen = 16
+)
+
+// LocalProvider authenticates users against email/password accounts stored in the users table
+type LocalProvider struct {
+	algorithm string
+	users     repository.UserRepository
+	// dummyHash is compared against when the account does not exist, so that
+	// unknown emails take as long to reject as wrong passwords
+	dummyHash string
+}
+
+// NewLocalProvider creates a local account provider for the accounts in users that hashes new passwords with algorithm
+func NewLocalProvider(algorithm string, users repository.UserRepository) (*LocalProvider, error) {
+	if algorithm == "" {
+		algorithm = HashArgon2id
+	}
+	l := &LocalProvider{algorithm: algorithm, users: users}
+	dummy, err := l.HashPassword("not-a-real-password")
+	if err != nil {
+		return nil, err
+	}
+	l.dummyHash = dummy
+	return l, nil
+}
+
+func (l *LocalProvider) Name() string { return "local" }
+
+func (l *LocalProvider) Authenticate(ctx context.Context, email, password string) (*Identity, error) {
+	creds, err := l.users.Credentials(ctx, email)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return nil, err
+	}
+	if err != nil || creds.PasswordHash == "" {
+		VerifyPassword(l.dummyHash, password)
+		return nil, ErrInvalidCredentials
+	}
+
+	ok, err := VerifyPassword(creds.PasswordHash, password)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+
+	// Local accounts are created with their email as the subject
+	return &Identity{
+		Provider: l.Name(),
+		Subject:  email,
+		Email:    email,
+		Name:     creds.Name,
+	}, nil
+}
+
+// NewPasswordHash checks that password is long enough for a new account and hashes it
+func (l *LocalProvider) NewPasswordHash(password string) (string, error) {
+	if len(password) < MinPasswordLength {
+		return "", fmt.Errorf("password must be at least %d characters", MinPasswordLength)
+	}
+	return l.HashPassword(password)
+}
+
+// HashPassword hashes password with the provider's configured algorithm
+func (l *LocalProvider) HashPassword(password string) (string, error) {
+	switch l.algorithm {
+	case HashArgon2id:
+		salt := make([]byte, argonSaltLen)
+		if _, err := rand.Read(salt); err != nil {
+			return "", err
+		}
+		key := argon2.IDKey([]byte(password), salt, argonTime, argonMemory, argonThreads, argonKeyLen)
+		return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, argonMemory, argonTime, argonThreads,
+			base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+	case HashBcrypt:
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		return string(hash), err
+	default:
+		return "", fmt.Errorf("unsupported password hash algorithm %q", l.algorithm)
+	}
+}
+
+// VerifyPassword checks password against an encoded argon2id or bcrypt hash
+func VerifyPassword(encoded, password string) (bool, error) {
+	if strings.HasPrefix(encoded, "$argon2id$") {
+		return verifyArgon2id(encoded, password)
+	}
+
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func verifyArgon2id(encoded, password string) (bool, error) {
+	// $argon2id$v=19$m=19456,t=2,p=1$<salt>$<key>
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return false, errors.New("malformed argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, errors.New("unsupported argon2id version")
+	}
+	var memory uint32
+	var time uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil {
+		return false, errors.New("malformed argon2id parameters")
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, err
+	}
+	want, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return false, err
+	}
+
+	got := argon2.IDKey([]byte(password), salt, time, memory, threads, uint32(len(want)))
+	return subtle.ConstantTimeCompare(got, want) == 1, nil
+}
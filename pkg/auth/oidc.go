@@ -0,0 +1,329 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/oauth2"
+)
+
+// OIDCProvider signs users in with any OpenID Connect compliant identity provider.
+// Endpoints are resolved through discovery and ID tokens are validated against the issuer's JWKS.
+type OIDCProvider struct {
+	name        string
+	config      *oauth2.Config
+	userInfoURL string
+	verifier    *idTokenVerifier
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserInfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// NewOIDCProvider fetches the issuer's discovery document and creates a provider for the given client
+func NewOIDCProvider(ctx context.Context, name, issuerURL, clientID, clientSecret, redirectURL string, scopes []string) (*OIDCProvider, error) {
+	issuerURL = strings.TrimSuffix(issuerURL, "/")
+
+	var doc oidcDiscovery
+	if err := fetchJSON(ctx, issuerURL+"/.well-known/openid-configuration", "", &doc); err != nil {
+		return nil, fmt.Errorf("oidc discovery failed: %w", err)
+	}
+	if strings.TrimSuffix(doc.Issuer, "/") != issuerURL {
+		return nil, fmt.Errorf("oidc discovery issuer mismatch: expected %q, got %q", issuerURL, doc.Issuer)
+	}
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.JWKSURI == "" {
+		return nil, errors.New("oidc discovery document is missing required endpoints")
+	}
+
+	if len(scopes) == 0 {
+		scopes = []string{"openid", "email", "profile"}
+	}
+
+	return &OIDCProvider{
+		name: name,
+		config: &oauth2.Config{
+			RedirectURL:  redirectURL,
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			Scopes:       scopes,
+			Endpoint: oauth2.Endpoint{
+				AuthURL:  doc.AuthorizationEndpoint,
+				TokenURL: doc.TokenEndpoint,
+			},
+		},
+		userInfoURL: doc.UserInfoEndpoint,
+		verifier:    newIDTokenVerifier([]string{doc.Issuer}, clientID, doc.JWKSURI),
+	}, nil
+}
+
+func (o *OIDCProvider) Name() string { return o.name }
+
+func (o *OIDCProvider) AuthCodeURL(flow LoginFlow) string {
+	return o.config.AuthCodeURL(flow.State, oauth2.S256ChallengeOption(flow.CodeVerifier), oauth2.SetAuthURLParam("nonce", flow.Nonce))
+}
+
+func (o *OIDCProvider) Exchange(ctx context.Context, code string, flow LoginFlow) (*Identity, error) {
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, httpClient)
+	token, err := o.config.Exchange(ctx, code, oauth2.VerifierOption(flow.CodeVerifier))
+	if err != nil {
+		return nil, fmt.Errorf("code exchange failed: %w", err)
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		return nil, errors.New("token response did not contain an id_token")
+	}
+
+	claims, err := o.verifier.Verify(ctx, rawIDToken, flow.Nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	// Some providers only put profile claims in the userinfo response
+	if claims.Email == "" && o.userInfoURL != "" {
+		if err := o.fillUserInfo(ctx, token.AccessToken, claims); err != nil {
+			return nil, err
+		}
+	}
+
+	if claims.Email == "" {
+		return nil, errors.New("identity provider did not return an email address")
+	}
+	// Members are matched to accounts by email, so only an address the
+	// provider explicitly verified is trusted; a missing claim is a rejection
+	if claims.EmailVerified == nil || !*claims.EmailVerified {
+		return nil, errors.New("email address is not verified by the identity provider")
+	}
+
+	return &Identity{
+		Provider: o.name,
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+		Name:     claims.Name,
+		Picture:  claims.Picture,
+	}, nil
+}
+
+// userInfoClaims are the userinfo response claims copied into the ID token claims
+type userInfoClaims struct {
+	Subject       string `json:"sub"`
+	Email         string `json:"email"`
+	EmailVerified *bool  `json:"email_verified,omitempty"`
+	Name          string `json:"name"`
+	Picture       string `json:"picture"`
+}
+
+// fillUserInfo copies the email and profile claims from the userinfo endpoint
+// into claims. The response is only trusted for the ID token's subject.
+func (o *OIDCProvider) fillUserInfo(ctx context.Context, accessToken string, claims *idTokenClaims) error {
+	var info userInfoClaims
+	if err := fetchJSON(ctx, o.userInfoURL, accessToken, &info); err != nil {
+		return fmt.Errorf("failed getting user info: %w", err)
+	}
+	if info.Subject != claims.Subject {
+		return errors.New("user info does not match the id_token subject")
+	}
+
+	claims.Email = info.Email
+	claims.EmailVerified = info.EmailVerified
+	if info.Name != "" {
+		claims.Name = info.Name
+	}
+	if info.Picture != "" {
+		claims.Picture = info.Picture
+	}
+	return nil
+}
+
+// idTokenClaims are the ID token claims used to build an Identity
+type idTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce         string `json:"nonce"`
+	Email         string `json:"email"`
+	EmailVerified *bool  `json:"email_verified,omitempty"`
+	Name          string `json:"name"`
+	Picture       string `json:"picture"`
+}
+
+// idTokenVerifier validates ID token signatures and standard claims for one client
+type idTokenVerifier struct {
+	issuers  []string
+	clientID string
+	jwksURL  string
+
+	mu          sync.Mutex
+	keys        map[string]interface{}
+	lastRefresh time.Time
+}
+
+// jwksMinRefreshInterval stops tokens with unknown key IDs from hammering the JWKS endpoint
+const jwksMinRefreshInterval = time.Minute
+
+// newIDTokenVerifier creates a verifier accepting tokens from any of issuers.
+// Most providers have exactly one; Google uses two spellings of its issuer.
+func newIDTokenVerifier(issuers []string, clientID, jwksURL string) *idTokenVerifier {
+	return &idTokenVerifier{issuers: issuers, clientID: clientID, jwksURL: jwksURL}
+}
+
+// Verify checks the token signature, issuer, audience, expiry and nonce and returns its claims
+func (v *idTokenVerifier) Verify(ctx context.Context, rawIDToken, nonce string) (*idTokenClaims, error) {
+	claims := &idTokenClaims{}
+	_, err := jwt.ParseWithClaims(rawIDToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return v.key(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}),
+		jwt.WithAudience(v.clientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid id_token: %w", err)
+	}
+	if !v.trustedIssuer(claims.Issuer) {
+		return nil, fmt.Errorf("invalid id_token: untrusted issuer %q", claims.Issuer)
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("invalid id_token: missing subject")
+	}
+	if subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1 {
+		return nil, errors.New("invalid id_token: nonce mismatch")
+	}
+	return claims, nil
+}
+
+func (v *idTokenVerifier) trustedIssuer(iss string) bool {
+	for _, trusted := range v.issuers {
+		if iss == trusted {
+			return true
+		}
+	}
+	return false
+}
+
+// key returns the verification key for kid, refreshing the key set if it is unknown
+func (v *idTokenVerifier) key(ctx context.Context, kid string) (interface{}, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if k, ok := v.lookup(kid); ok {
+		return k, nil
+	}
+	if time.Since(v.lastRefresh) < jwksMinRefreshInterval {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	keys, err := fetchJWKS(ctx, v.jwksURL)
+	v.lastRefresh = time.Now()
+	if err != nil {
+		return nil, err
+	}
+	v.keys = keys
+
+	if k, ok := v.lookup(kid); ok {
+		return k, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// lookup finds a key by ID. Tokens without a kid are accepted only when the set has a single key.
+func (v *idTokenVerifier) lookup(kid string) (interface{}, bool) {
+	if kid == "" && len(v.keys) == 1 {
+		for _, k := range v.keys {
+			return k, true
+		}
+	}
+	k, ok := v.keys[kid]
+	return k, ok
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func fetchJWKS(ctx context.Context, url string) (map[string]interface{}, error) {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := fetchJSON(ctx, url, "", &set); err != nil {
+		return nil, fmt.Errorf("failed fetching jwks: %w", err)
+	}
+
+	keys := make(map[string]interface{}, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		pub, err := k.publicKey()
+		if err != nil {
+			// Skip keys we cannot use rather than failing the whole set
+			continue
+		}
+		keys[k.Kid] = pub
+	}
+	return keys, nil
+}
+
+func (k jsonWebKey) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		pub := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, errors.New("ec key is not on its curve")
+		}
+		return pub, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
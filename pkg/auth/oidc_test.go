@@ -0,0 +1,234 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testClientID = "library-client"
+	testKeyID    = "test-key"
+	testNonce    = "nonce-123"
+)
+
+// fakeIdP is an in-process OpenID Connect provider serving discovery, JWKS,
+// token and userinfo endpoints. claims builds the ID token for each exchange.
+type fakeIdP struct {
+	*httptest.Server
+	key      *rsa.PrivateKey
+	signer   *rsa.PrivateKey // Signs ID tokens; key unless a test swaps it
+	claims   jwt.MapClaims
+	userInfo map[string]interface{}
+}
+
+func newFakeIdP(t *testing.T) *fakeIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &fakeIdP{key: key, signer: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]string{
+			"issuer":                 idp.URL,
+			"authorization_endpoint": idp.URL + "/authorize",
+			"token_endpoint":         idp.URL + "/token",
+			"userinfo_endpoint":      idp.URL + "/userinfo",
+			"jwks_uri":               idp.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": testKeyID,
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("code") != "good-code" || r.FormValue("code_verifier") == "" {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, idp.claims)
+		token.Header["kid"] = testKeyID
+		idToken, err := token.SignedString(idp.signer)
+		if err != nil {
+			t.Error(err)
+		}
+		writeJSON(w, map[string]string{"access_token": "access-token", "token_type": "Bearer", "id_token": idToken})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer access-token" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		writeJSON(w, idp.userInfo)
+	})
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+	return idp
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// validClaims are the claims of an ID token the provider must accept
+func (idp *fakeIdP) validClaims() jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":            idp.URL,
+		"sub":            "user-42",
+		"aud":            testClientID,
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Hour).Unix(),
+		"nonce":          testNonce,
+		"email":          "reader@example.com",
+		"email_verified": true,
+		"name":           "Ada Reader",
+	}
+}
+
+func newTestProvider(t *testing.T, idp *fakeIdP) *OIDCProvider {
+	t.Helper()
+	p, err := NewOIDCProvider(context.Background(), "test", idp.URL, testClientID, "secret", "http://localhost/auth/test/callback", nil)
+	if err != nil {
+		t.Fatalf("NewOIDCProvider: %v", err)
+	}
+	return p
+}
+
+func testFlow() LoginFlow {
+	return LoginFlow{State: "state", Nonce: testNonce, CodeVerifier: "verifier-0123456789-0123456789-0123456789"}
+}
+
+func TestOIDCExchange(t *testing.T) {
+	idp := newFakeIdP(t)
+	idp.claims = idp.validClaims()
+	p := newTestProvider(t, idp)
+
+	identity, err := p.Exchange(context.Background(), "good-code", testFlow())
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	want := Identity{Provider: "test", Subject: "user-42", Email: "reader@example.com", Name: "Ada Reader"}
+	if *identity != want {
+		t.Errorf("identity = %+v, want %+v", *identity, want)
+	}
+}
+
+func TestOIDCExchangeUserInfo(t *testing.T) {
+	idp := newFakeIdP(t)
+	idp.claims = idp.validClaims()
+	delete(idp.claims, "email")
+	delete(idp.claims, "email_verified")
+	idp.userInfo = map[string]interface{}{"sub": "user-42", "email": "reader@example.com", "email_verified": true}
+	p := newTestProvider(t, idp)
+
+	identity, err := p.Exchange(context.Background(), "good-code", testFlow())
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if identity.Email != "reader@example.com" {
+		t.Errorf("email = %q, want the userinfo email", identity.Email)
+	}
+}
+
+func TestOIDCExchangeUserInfoRejects(t *testing.T) {
+	tests := []struct {
+		name     string
+		userInfo map[string]interface{}
+		wantErr  string
+	}{
+		{"other subject", map[string]interface{}{"sub": "user-7", "email": "admin@example.com", "email_verified": true}, "subject"},
+		{"missing subject", map[string]interface{}{"email": "admin@example.com", "email_verified": true}, "subject"},
+		{"unverified email", map[string]interface{}{"sub": "user-42", "email": "reader@example.com", "email_verified": false}, "not verified"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp := newFakeIdP(t)
+			idp.claims = idp.validClaims()
+			delete(idp.claims, "email")
+			delete(idp.claims, "email_verified")
+			idp.userInfo = tt.userInfo
+			p := newTestProvider(t, idp)
+
+			identity, err := p.Exchange(context.Background(), "good-code", testFlow())
+			if err == nil {
+				t.Fatalf("Exchange accepted the user info: %+v", identity)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %q, want it to mention %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOIDCExchangeRejects(t *testing.T) {
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(idp *fakeIdP)
+		wantErr string
+	}{
+		{"bad nonce", func(idp *fakeIdP) { idp.claims["nonce"] = "other-nonce" }, "nonce mismatch"},
+		{"missing nonce", func(idp *fakeIdP) { delete(idp.claims, "nonce") }, "nonce mismatch"},
+		{"wrong issuer", func(idp *fakeIdP) { idp.claims["iss"] = "https://evil.example.com" }, "untrusted issuer"},
+		{"wrong audience", func(idp *fakeIdP) { idp.claims["aud"] = "another-client" }, "audience"},
+		{"expired token", func(idp *fakeIdP) {
+			idp.claims["iat"] = time.Now().Add(-2 * time.Hour).Unix()
+			idp.claims["exp"] = time.Now().Add(-time.Hour).Unix()
+		}, "expired"},
+		{"missing expiry", func(idp *fakeIdP) { delete(idp.claims, "exp") }, "exp"},
+		{"bad signature", func(idp *fakeIdP) { idp.signer = otherKey }, "signature"},
+		{"missing subject", func(idp *fakeIdP) { delete(idp.claims, "sub") }, "missing subject"},
+		{"unverified email", func(idp *fakeIdP) { idp.claims["email_verified"] = false }, "not verified"},
+		{"email_verified omitted", func(idp *fakeIdP) { delete(idp.claims, "email_verified") }, "not verified"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp := newFakeIdP(t)
+			idp.claims = idp.validClaims()
+			tt.modify(idp)
+			p := newTestProvider(t, idp)
+
+			identity, err := p.Exchange(context.Background(), "good-code", testFlow())
+			if err == nil {
+				t.Fatalf("Exchange accepted the token: %+v", identity)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %q, want it to mention %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOIDCExchangeBadCode(t *testing.T) {
+	idp := newFakeIdP(t)
+	idp.claims = idp.validClaims()
+	p := newTestProvider(t, idp)
+
+	if _, err := p.Exchange(context.Background(), "stolen-code", testFlow()); err == nil {
+		t.Fatal("Exchange accepted a code the provider rejected")
+	}
+}
@@ -0,0 +1,43 @@
+package auth
+
+// Permissions checked by the GraphQL resolvers
+const (
+	PermBooksRead        = "books:read"
+	PermBooksWrite       = "books:write"
+	PermMembersRead      = "members:read"
+	PermMembersWrite     = "members:write"
+	PermBorrowsRead      = "borrows:read"
+	PermCirculationWrite = "circulation:write"
+	PermAccountsManage   = "accounts:manage"
+	PermAPIKeysManage    = "apikeys:manage"
+	PermAuditRead        = "audit:read"
+)
+
+// rolePermissions maps each user role to the permissions it grants
+var rolePermissions = map[string][]string{
+	"ADMIN": {
+		PermBooksRead, PermBooksWrite,
+		PermMembersRead, PermMembersWrite,
+		PermBorrowsRead, PermCirculationWrite,
+		PermAccountsManage, PermAPIKeysManage,
+		PermAuditRead,
+	},
+	"LIBRARIAN": {PermBooksRead, PermMembersRead, PermBorrowsRead, PermCirculationWrite},
+	"MEMBER":    {PermBooksRead},
+}
+
+// grantablePermissions are the permissions that may be given to an API key.
+// Account and key management always require a human ADMIN.
+var grantablePermissions = map[string]bool{
+	PermBooksRead:        true,
+	PermBooksWrite:       true,
+	PermMembersRead:      true,
+	PermMembersWrite:     true,
+	PermBorrowsRead:      true,
+	PermCirculationWrite: true,
+}
+
+// PermissionsForRole returns the permissions granted to role
+func PermissionsForRole(role string) []string {
+	return rolePermissions[role]
+}
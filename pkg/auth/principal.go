@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"context"
+	"log/slog"
+)
+
+// AuthMethod records how a principal authenticated
+type AuthMethod string
+
+const (
+	AuthMethodSessionCookie AuthMethod = "session_cookie"
+	AuthMethodBearer        AuthMethod = "bearer"
+	AuthMethodAPIKey        AuthMethod = "api_key"
+)
+
+// Principal is the authenticated caller of a request
+type Principal struct {
+	UserID      int // 0 for API keys, which are not tied to a user
+	MemberID    int // Library member linked to the user by email, 0 if none
+	Role        string
+	Permissions []string
+	AuthMethod  AuthMethod
+	TokenID     string // Session token jti or API key id
+}
+
+// Has reports whether the principal holds perm
+func (p *Principal) Has(perm string) bool {
+	for _, granted := range p.Permissions {
+		if granted == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// IsUser reports whether the principal is a signed-in user rather than a service account
+func (p *Principal) IsUser() bool {
+	return p.UserID != 0
+}
+
+// LogValue identifies the principal in logs without its permissions
+func (p *Principal) LogValue() slog.Value {
+	attrs := []slog.Attr{slog.String("auth_method", string(p.AuthMethod))}
+	if p.IsUser() {
+		attrs = append(attrs, slog.Int("user_id", p.UserID), slog.String("role", p.Role))
+	}
+	if p.TokenID != "" {
+		attrs = append(attrs, slog.String("token_id", p.TokenID))
+	}
+	return slog.GroupValue(attrs...)
+}
+
+// principalKey is unexported so no other package can set or collide with the principal
+type principalKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying p
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFrom returns the authenticated principal stored by AuthMiddleware
+func PrincipalFrom(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok && p != nil
+}
+
+// HasPermission reports whether the authenticated caller holds perm.
+// Users get the permissions of their role; API keys only those they were created with.
+func HasPermission(ctx context.Context, perm string) bool {
+	p, ok := PrincipalFrom(ctx)
+	return ok && p.Has(perm)
+}
@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"sort"
+)
+
+// Identity is the normalized user profile returned by an identity provider
+type Identity struct {
+	Provider string
+	Subject  string
+	Email    string
+	Name     string
+	Picture  string
+}
+
+// Provider is implemented by every identity provider
+type Provider interface {
+	// Name is the URL-safe identifier used in the /auth/{name}/... routes
+	Name() string
+}
+
+// RedirectProvider authenticates users through a browser redirect (OAuth 2.0 / OpenID Connect)
+type RedirectProvider interface {
+	Provider
+	// AuthCodeURL returns the provider's consent URL for a new login flow
+	AuthCodeURL(flow LoginFlow) string
+	// Exchange redeems the authorization code and returns the verified identity.
+	// Implementations must send flow.CodeVerifier and check flow.Nonce where the provider supports it.
+	Exchange(ctx context.Context, code string, flow LoginFlow) (*Identity, error)
+}
+
+// PasswordProvider authenticates users with an email and password
+type PasswordProvider interface {
+	Provider
+	Authenticate(ctx context.Context, email, password string) (*Identity, error)
+}
+
+// ErrInvalidCredentials is returned by a PasswordProvider when the email or password is wrong
+var ErrInvalidCredentials = errors.New("invalid email or password")
+
+var providers = map[string]Provider{}
+
+// RegisterProvider makes an identity provider available to the auth handlers
+func RegisterProvider(p Provider) {
+	providers[p.Name()] = p
+}
+
+// GetProvider returns the registered provider with the given name
+func GetProvider(name string) (Provider, bool) {
+	p, ok := providers[name]
+	return p, ok
+}
+
+// RedirectProviders returns all registered redirect-based providers, sorted by name
+func RedirectProviders() []RedirectProvider {
+	var list []RedirectProvider
+	for _, p := range providers {
+		if rp, ok := p.(RedirectProvider); ok {
+			list = append(list, rp)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name() < list[j].Name() })
+	return list
+}
@@ -0,0 +1,105 @@
+// Package cache keeps recently read values in process. Entries expire after
+// the TTL they were stored with, and the least recently used entry makes room
+// when the cache is full.
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"library-system/pkg/metrics"
+)
+
+// Config controls the catalog cache; see package config for the defaults
+type Config struct {
+	Enabled bool
+	ListTTL time.Duration // Book lists
+}
+
+// Cache stores values by key. Values are shared between callers and must not
+// be modified.
+type Cache interface {
+	// Get returns the live value stored under key
+	Get(key string) (any, bool)
+	// Set stores value under key until ttl has passed
+	Set(key string, value any, ttl time.Duration)
+	// Delete removes keys, live or not
+	Delete(keys ...string)
+}
+
+// LRU is a Cache holding at most a fixed number of entries. Its hits, misses
+// and evictions are exported as metrics labelled with its name.
+type LRU struct {
+	name string
+	size int
+	now  func() time.Time
+
+	mu      sync.Mutex
+	order   *list.List // Front is the most recently used
+	entries map[string]*list.Element
+}
+
+type entry struct {
+	key     string
+	value   any
+	expires time.Time
+}
+
+var _ Cache = (*LRU)(nil)
+
+// NewLRU returns an empty cache holding at most size entries
+func NewLRU(name string, size int) *LRU {
+	return &LRU{name: name, size: size, now: time.Now, order: list.New(), entries: map[string]*list.Element{}}
+}
+
+func (c *LRU) Get(key string) (any, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if ok && c.now().After(el.Value.(*entry).expires) {
+		c.remove(el)
+		ok = false
+	}
+	if !ok {
+		metrics.CacheRequests.WithLabelValues(c.name, "miss").Inc()
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	metrics.CacheRequests.WithLabelValues(c.name, "hit").Inc()
+	return el.Value.(*entry).value, true
+}
+
+func (c *LRU) Set(key string, value any, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	expires := c.now().Add(ttl)
+	if el, ok := c.entries[key]; ok {
+		e := el.Value.(*entry)
+		e.value, e.expires = value, expires
+		c.order.MoveToFront(el)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&entry{key: key, value: value, expires: expires})
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+		metrics.CacheEvictions.WithLabelValues(c.name).Inc()
+	}
+	metrics.CacheEntries.WithLabelValues(c.name).Set(float64(c.order.Len()))
+}
+
+func (c *LRU) Delete(keys ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, key := range keys {
+		if el, ok := c.entries[key]; ok {
+			c.remove(el)
+		}
+	}
+	metrics.CacheEntries.WithLabelValues(c.name).Set(float64(c.order.Len()))
+}
+
+func (c *LRU) remove(el *list.Element) {
+	c.order.Remove(el)
+	delete(c.entries, el.Value.(*entry).key)
+}
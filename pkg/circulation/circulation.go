@@ -0,0 +1,203 @@
+// Package circulation holds the lending rules: checking books out, checking
+// them back in and renewing loans. The GraphQL resolvers, batch jobs and any
+// other entry point go through Service so the rules live in one place.
+package circulation
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"library-system/pkg/audit"
+	"library-system/pkg/metrics"
+	"library-system/pkg/models"
+	"library-system/pkg/repository"
+)
+
+// Loan statuses stored in borrow.status
+const (
+	StatusBorrowed = "borrowed"
+	StatusReturned = "returned"
+)
+
+// Defaults for the lending policy
+const (
+	DefaultLoanPeriod  = 14 * 24 * time.Hour
+	DefaultMaxRenewals = 2
+)
+
+// Policy is the lending policy applied to new loans and renewals
+type Policy struct {
+	LoanPeriod  time.Duration // Time until a new loan is due; each renewal adds the same again
+	MaxRenewals int           // Renewals allowed per loan
+	MaxLoans    int           // Active loans allowed per member; 0 means no limit
+}
+
+// DefaultPolicy is the policy used when nothing is configured
+var DefaultPolicy = Policy{LoanPeriod: DefaultLoanPeriod, MaxRenewals: DefaultMaxRenewals}
+
+// Service performs circulation operations. Each one runs in a transaction,
+// records an audit entry and returns an *Error when a rule is broken.
+// Permission checks are left to the caller.
+type Service struct {
+	store  repository.Store
+	policy Policy
+	now    func() time.Time
+}
+
+// NewService creates a service on store applying policy
+func NewService(store repository.Store, policy Policy) *Service {
+	return &Service{store: store, policy: policy, now: time.Now}
+}
+
+// WithStore returns a copy of the service working on store, typically a
+// transaction the caller already holds
+func (s *Service) WithStore(store repository.Store) *Service {
+	c := *s
+	c.store = store
+	return &c
+}
+
+// Policy returns the lending policy in effect
+func (s *Service) Policy() Policy {
+	return s.policy
+}
+
+// Checkout lends a copy of a book to a member
+func (s *Service) Checkout(ctx context.Context, memberID, bookID int) (models.Borrow, error) {
+	var loan models.Borrow
+	err := s.store.InTx(ctx, func(tx repository.Store) error {
+		// Deleted members cannot borrow; the lock blocks a concurrent delete
+		member, err := tx.Members().GetForUpdate(ctx, memberID)
+		if err := checkLive(err, member.DeletedAt, ErrMemberNotFound); err != nil {
+			return err
+		}
+		book, err := tx.Books().GetForUpdate(ctx, bookID)
+		if err := checkLive(err, book.DeletedAt, ErrBookNotFound); err != nil {
+			return err
+		}
+		// The member lock keeps concurrent checkouts from both passing the limit
+		activeLoans, err := tx.Borrows().CountActiveByMember(ctx, memberID)
+		if err != nil {
+			return err
+		}
+		if err := canCheckout(book, activeLoans, s.policy); err != nil {
+			return err
+		}
+
+		if err := tx.Books().AdjustAvailable(ctx, bookID, -1); err != nil {
+			return err
+		}
+		loan, err = tx.Borrows().Create(ctx, memberID, bookID, s.now().Add(s.policy.LoanPeriod))
+		if err != nil {
+			return err
+		}
+		// Counted once committed, so retried transactions count once
+		tx.OnCommit(metrics.Borrows.Inc)
+		return audit.Record(ctx, tx.AuditLog(), "borrowBook", "borrow", loan.ID, nil, loan)
+	})
+	return loan, err
+}
+
+// Checkin ends a loan and puts the copy back on the shelf
+func (s *Service) Checkin(ctx context.Context, borrowID int) (models.Borrow, error) {
+	var loan models.Borrow
+	err := s.store.InTx(ctx, func(tx repository.Store) error {
+		before, err := lockLoan(ctx, tx, borrowID)
+		if err != nil {
+			return err
+		}
+		if err := canCheckin(before); err != nil {
+			return err
+		}
+
+		loan, err = tx.Borrows().MarkReturned(ctx, borrowID)
+		if err != nil {
+			return err
+		}
+		if err := tx.Books().AdjustAvailable(ctx, before.BookID, 1); err != nil {
+			return err
+		}
+		tx.OnCommit(metrics.Returns.Inc)
+		return audit.Record(ctx, tx.AuditLog(), "returnBook", "borrow", loan.ID, before, loan)
+	})
+	return loan, err
+}
+
+// Renew extends an active loan by another loan period, counted from its current due date
+func (s *Service) Renew(ctx context.Context, borrowID int) (models.Borrow, error) {
+	var loan models.Borrow
+	err := s.store.InTx(ctx, func(tx repository.Store) error {
+		before, err := lockLoan(ctx, tx, borrowID)
+		if err != nil {
+			return err
+		}
+		if err := canRenew(before, s.policy, s.now()); err != nil {
+			return err
+		}
+
+		loan, err = tx.Borrows().Renew(ctx, borrowID, before.DueDate.Add(s.policy.LoanPeriod))
+		if err != nil {
+			return err
+		}
+		tx.OnCommit(metrics.Renewals.Inc)
+		return audit.Record(ctx, tx.AuditLog(), "renewBook", "borrow", loan.ID, before, loan)
+	})
+	return loan, err
+}
+
+// CountOverdue counts active loans past their due date
+func (s *Service) CountOverdue(ctx context.Context) (int, error) {
+	return s.store.Borrows().CountOverdue(ctx, s.now())
+}
+
+// canCheckout reports whether a copy of book can be lent to a member with
+// activeLoans loans under policy
+func canCheckout(book models.Book, activeLoans int, policy Policy) error {
+	if book.AvailableCopies <= 0 {
+		return ErrBookUnavailable
+	}
+	if policy.MaxLoans > 0 && activeLoans >= policy.MaxLoans {
+		return ErrLoanLimitReached
+	}
+	return nil
+}
+
+// canCheckin reports whether loan can be returned
+func canCheckin(loan models.Borrow) error {
+	if loan.Status == StatusReturned {
+		return ErrAlreadyReturned
+	}
+	return nil
+}
+
+// canRenew reports whether loan can be renewed at now under policy
+func canRenew(loan models.Borrow, policy Policy, now time.Time) error {
+	if loan.Status == StatusReturned {
+		return ErrAlreadyReturned
+	}
+	if now.After(loan.DueDate) {
+		return ErrLoanOverdue
+	}
+	if loan.Renewals >= policy.MaxRenewals {
+		return ErrRenewalsExceeded
+	}
+	return nil
+}
+
+// lockLoan locks a borrow record for update
+func lockLoan(ctx context.Context, tx repository.Store, id int) (models.Borrow, error) {
+	loan, err := tx.Borrows().GetForUpdate(ctx, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return loan, ErrLoanNotFound
+	}
+	return loan, err
+}
+
+// checkLive maps a failed or soft-deleted lookup to missing
+func checkLive(err error, deletedAt *time.Time, missing error) error {
+	if errors.Is(err, repository.ErrNotFound) || (err == nil && deletedAt != nil) {
+		return missing
+	}
+	return err
+}
@@ -0,0 +1,279 @@
+package circulation
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"library-system/pkg/models"
+	"library-system/pkg/repository"
+)
+
+var testPolicy = Policy{LoanPeriod: 14 * 24 * time.Hour, MaxRenewals: 2, MaxLoans: 2}
+
+func TestCanCheckout(t *testing.T) {
+	tests := []struct {
+		name        string
+		available   int
+		activeLoans int
+		policy      Policy
+		want        error
+	}{
+		{"copy available", 1, 0, testPolicy, nil},
+		{"no copies available", 0, 0, testPolicy, ErrBookUnavailable},
+		{"below loan limit", 1, 1, testPolicy, nil},
+		{"at loan limit", 1, 2, testPolicy, ErrLoanLimitReached},
+		{"no loan limit", 1, 100, Policy{LoanPeriod: time.Hour}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := canCheckout(models.Book{AvailableCopies: tt.available}, tt.activeLoans, tt.policy)
+			if err != tt.want {
+				t.Errorf("canCheckout = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanCheckin(t *testing.T) {
+	tests := []struct {
+		name   string
+		status string
+		want   error
+	}{
+		{"borrowed", StatusBorrowed, nil},
+		{"already returned", StatusReturned, ErrAlreadyReturned},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := canCheckin(models.Borrow{Status: tt.status}); err != tt.want {
+				t.Errorf("canCheckin = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanRenew(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		loan models.Borrow
+		want error
+	}{
+		{"active", models.Borrow{Status: StatusBorrowed, DueDate: now.Add(time.Hour)}, nil},
+		{"due now", models.Borrow{Status: StatusBorrowed, DueDate: now}, nil},
+		{"last renewal", models.Borrow{Status: StatusBorrowed, DueDate: now.Add(time.Hour), Renewals: 1}, nil},
+		{"renewal limit", models.Borrow{Status: StatusBorrowed, DueDate: now.Add(time.Hour), Renewals: 2}, ErrRenewalsExceeded},
+		{"overdue", models.Borrow{Status: StatusBorrowed, DueDate: now.Add(-time.Second)}, ErrLoanOverdue},
+		{"already returned", models.Borrow{Status: StatusReturned, DueDate: now.Add(time.Hour)}, ErrAlreadyReturned},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := canRenew(tt.loan, testPolicy, now); err != tt.want {
+				t.Errorf("canRenew = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+// fixture is a MemoryStore holding a member and books with the given copies
+type fixture struct {
+	store  *repository.MemoryStore
+	svc    *Service
+	member models.Member
+	books  []models.Book
+}
+
+func newFixture(t *testing.T, copies ...int) *fixture {
+	t.Helper()
+	ctx := context.Background()
+	store := repository.NewMemoryStore()
+	member, err := store.Members().Create(ctx, models.Member{Name: "Ada", Email: "ada@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fixture{store: store, svc: NewService(store, testPolicy), member: member}
+	for _, n := range copies {
+		b, err := store.Books().Create(ctx, models.Book{Title: "Dune", Author: "Frank Herbert", PublishedYear: 1965, TotalCopies: n})
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.books = append(f.books, b)
+	}
+	return f
+}
+
+func (f *fixture) auditEntries(t *testing.T) int {
+	t.Helper()
+	n, err := f.store.AuditLog().Count(context.Background(), repository.AuditFilter{EntityType: "borrow"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func (f *fixture) available(t *testing.T, bookID int) int {
+	t.Helper()
+	b, err := f.store.Books().Get(context.Background(), bookID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b.AvailableCopies
+}
+
+func TestCheckout(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t, 1)
+	book := f.books[0]
+
+	loan, err := f.svc.Checkout(ctx, f.member.ID, book.ID)
+	if err != nil {
+		t.Fatalf("Checkout: %v", err)
+	}
+	if loan.Status != StatusBorrowed || loan.MemberID != f.member.ID || loan.BookID != book.ID {
+		t.Errorf("loan = %+v", loan)
+	}
+	if got := f.available(t, book.ID); got != 0 {
+		t.Errorf("available copies = %d, want 0", got)
+	}
+
+	if _, err := f.svc.Checkout(ctx, f.member.ID, book.ID); !errors.Is(err, ErrBookUnavailable) {
+		t.Errorf("second Checkout = %v, want %v", err, ErrBookUnavailable)
+	}
+}
+
+func TestCheckoutRejects(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name  string
+		setup func(t *testing.T, f *fixture) (memberID, bookID int)
+		want  error
+	}{
+		{"no copies available", func(t *testing.T, f *fixture) (int, int) {
+			return f.member.ID, f.books[3].ID
+		}, ErrBookUnavailable},
+		{"loan limit", func(t *testing.T, f *fixture) (int, int) {
+			for _, b := range f.books[:2] {
+				if _, err := f.svc.Checkout(ctx, f.member.ID, b.ID); err != nil {
+					t.Fatal(err)
+				}
+			}
+			return f.member.ID, f.books[2].ID
+		}, ErrLoanLimitReached},
+		{"unknown member", func(t *testing.T, f *fixture) (int, int) {
+			return f.member.ID + 100, f.books[0].ID
+		}, ErrMemberNotFound},
+		{"deleted member", func(t *testing.T, f *fixture) (int, int) {
+			if _, err := f.store.Members().SoftDelete(ctx, f.member.ID, nil); err != nil {
+				t.Fatal(err)
+			}
+			return f.member.ID, f.books[0].ID
+		}, ErrMemberNotFound},
+		{"deleted book", func(t *testing.T, f *fixture) (int, int) {
+			if _, err := f.store.Books().SoftDelete(ctx, f.books[0].ID, nil); err != nil {
+				t.Fatal(err)
+			}
+			return f.member.ID, f.books[0].ID
+		}, ErrBookNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture(t, 1, 1, 1, 0)
+			memberID, bookID := tt.setup(t, f)
+			entries := f.auditEntries(t)
+
+			if _, err := f.svc.Checkout(ctx, memberID, bookID); !errors.Is(err, tt.want) {
+				t.Fatalf("Checkout = %v, want %v", err, tt.want)
+			}
+			if got := f.auditEntries(t); got != entries {
+				t.Errorf("rejected Checkout wrote %d audit entries", got-entries)
+			}
+		})
+	}
+}
+
+func TestCheckin(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t, 1)
+	book := f.books[0]
+	loan, err := f.svc.Checkout(ctx, f.member.ID, book.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	returned, err := f.svc.Checkin(ctx, loan.ID)
+	if err != nil {
+		t.Fatalf("Checkin: %v", err)
+	}
+	if returned.Status != StatusReturned || returned.ReturnDate == nil {
+		t.Errorf("loan = %+v, want it returned", returned)
+	}
+	if got := f.available(t, book.ID); got != 1 {
+		t.Errorf("available copies = %d, want 1", got)
+	}
+
+	// A second return must not put another copy on the shelf
+	if _, err := f.svc.Checkin(ctx, loan.ID); !errors.Is(err, ErrAlreadyReturned) {
+		t.Errorf("second Checkin = %v, want %v", err, ErrAlreadyReturned)
+	}
+	if got := f.available(t, book.ID); got != 1 {
+		t.Errorf("available copies after second Checkin = %d, want 1", got)
+	}
+	if _, err := f.svc.Checkin(ctx, loan.ID+100); !errors.Is(err, ErrLoanNotFound) {
+		t.Errorf("Checkin of unknown loan = %v, want %v", err, ErrLoanNotFound)
+	}
+}
+
+func TestRenew(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name     string
+		renewals int           // Successful renewals before the checked one
+		returned bool          // Check the loan in first
+		elapsed  time.Duration // Time past the due date at the checked renewal
+		want     error
+	}{
+		{"first renewal", 0, false, 0, nil},
+		{"last renewal", 1, false, 0, nil},
+		{"renewal limit", 2, false, 0, ErrRenewalsExceeded},
+		{"overdue", 0, false, time.Minute, ErrLoanOverdue},
+		{"already returned", 0, true, 0, ErrAlreadyReturned},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture(t, 1)
+			now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+			f.svc.now = func() time.Time { return now }
+			loan, err := f.svc.Checkout(ctx, f.member.ID, f.books[0].ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < tt.renewals; i++ {
+				if loan, err = f.svc.Renew(ctx, loan.ID); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.returned {
+				if _, err := f.svc.Checkin(ctx, loan.ID); err != nil {
+					t.Fatal(err)
+				}
+			}
+			now = loan.DueDate.Add(tt.elapsed)
+
+			renewed, err := f.svc.Renew(ctx, loan.ID)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Renew = %v, want %v", err, tt.want)
+			}
+			if err != nil {
+				return
+			}
+			if want := loan.DueDate.Add(testPolicy.LoanPeriod); !renewed.DueDate.Equal(want) {
+				t.Errorf("due date = %v, want %v", renewed.DueDate, want)
+			}
+			if renewed.Renewals != tt.renewals+1 {
+				t.Errorf("renewals = %d, want %d", renewed.Renewals, tt.renewals+1)
+			}
+		})
+	}
+}
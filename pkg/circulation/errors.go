@@ -0,0 +1,23 @@
+package circulation
+
+// Error is a broken circulation rule. Code is stable for clients to match on;
+// compare with errors.Is against the values below.
+type Error struct {
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+var (
+	ErrMemberNotFound   = &Error{Code: "MEMBER_NOT_FOUND", Message: "member not found"}
+	ErrBookNotFound     = &Error{Code: "BOOK_NOT_FOUND", Message: "book not found"}
+	ErrLoanNotFound     = &Error{Code: "LOAN_NOT_FOUND", Message: "borrow record not found"}
+	ErrBookUnavailable  = &Error{Code: "BOOK_UNAVAILABLE", Message: "book not available"}
+	ErrLoanLimitReached = &Error{Code: "LOAN_LIMIT_REACHED", Message: "member has reached the loan limit"}
+	ErrAlreadyReturned  = &Error{Code: "ALREADY_RETURNED", Message: "book already returned"}
+	ErrLoanOverdue      = &Error{Code: "LOAN_OVERDUE", Message: "overdue loans cannot be renewed"}
+	ErrRenewalsExceeded = &Error{Code: "RENEWAL_LIMIT_REACHED", Message: "renewal limit reached"}
+)
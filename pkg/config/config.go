@@ -0,0 +1,431 @@
+// Package config loads the server configuration. Values come from, in
+// increasing order of precedence: built-in defaults, an optional YAML or TOML
+// file, environment variables and command-line flags. The result is passed
+// explicitly to each subsystem at startup; nothing else reads the environment.
+package config
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"library-system/pkg/admin"
+	"library-system/pkg/auth"
+	"library-system/pkg/cache"
+	"library-system/pkg/circulation"
+	"library-system/pkg/cors"
+	"library-system/pkg/db"
+	"library-system/pkg/httpx"
+	"library-system/pkg/idempotency"
+	"library-system/pkg/jobs"
+	"library-system/pkg/logging"
+	"library-system/pkg/ratelimit"
+	"library-system/pkg/repository"
+	"library-system/pkg/schema"
+	"library-system/pkg/tracing"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the complete server configuration
+type Config struct {
+	Server       ServerConfig
+	Admin        admin.Config
+	Database     db.Config
+	Transactions repository.TxOptions
+	Cache        cache.Config
+	CORS         cors.Config
+	Auth         auth.Config
+	RateLimit    ratelimit.Config
+	Circulation  circulation.Policy
+	Idempotency  IdempotencyConfig
+	Jobs         JobsConfig
+	Tracing      tracing.Config
+	Log          logging.Config
+
+	File        string   // Config file the values were read from, if any
+	PrintConfig bool     // Print the effective configuration and exit
+	Args        []string // Command-line arguments after the flags
+}
+
+// Environments selectable with ServerConfig.Environment
+const (
+	EnvDevelopment = "development"
+	EnvProduction  = "production" // GraphiQL and introspection default to off
+)
+
+// ServerConfig configures the HTTP server
+type ServerConfig struct {
+	Port            int
+	Environment     string
+	GraphiQL        bool // Serve the playground on the public /graphql endpoint
+	Introspection   bool // Answer __schema and __type queries on the public endpoint
+	PrettyJSON      bool // Indent GraphQL responses
+	Compression     bool // gzip or brotli, as the client prefers
+	CompressMinSize int  // Smaller responses are sent uncompressed
+	TrustedProxies  int  // Proxies appending to X-Forwarded-For; the client IP is that many entries from the right
+	MigrateOnBoot   bool
+
+	ReadTimeout       time.Duration // Whole request, including the body
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration // From the end of the request headers to the end of the response
+	IdleTimeout       time.Duration // Keep-alive connections
+	MaxHeaderBytes    int
+
+	DrainDelay      time.Duration // How long the server keeps serving after reporting not ready on shutdown
+	ShutdownTimeout time.Duration // Deadline for in-flight requests to finish on shutdown
+	HealthTimeout   time.Duration // Deadline for the checks behind /readyz
+	ResolverTimeout time.Duration // Deadline for each top-level GraphQL field; 0 disables
+}
+
+// IdempotencyConfig configures replay of idempotent mutations
+type IdempotencyConfig struct {
+	KeyTTL          time.Duration
+	CleanupInterval time.Duration
+}
+
+// JobsConfig configures the background jobs
+type JobsConfig struct {
+	SoftDeleteRetention time.Duration
+	PurgeInterval       time.Duration
+}
+
+// Default returns the built-in defaults. There is no default database
+// connection string or JWT secret; both must be configured.
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Port:              8080,
+			Environment:       EnvDevelopment,
+			Compression:       true,
+			CompressMinSize:   httpx.DefaultCompressMinSize,
+			ReadTimeout:       30 * time.Second,
+			ReadHeaderTimeout: 5 * time.Second,
+			WriteTimeout:      60 * time.Second,
+			IdleTimeout:       120 * time.Second,
+			MaxHeaderBytes:    1 << 20,
+			DrainDelay:        5 * time.Second,
+			ShutdownTimeout:   30 * time.Second,
+			HealthTimeout:     2 * time.Second,
+			ResolverTimeout:   schema.DefaultResolverTimeout,
+		},
+		Admin: admin.Config{Addr: "127.0.0.1:6060"},
+		Transactions: repository.TxOptions{
+			Isolation:   sql.LevelReadCommitted,
+			MaxAttempts: repository.DefaultTxOptions.MaxAttempts,
+			RetryDelay:  repository.DefaultTxOptions.RetryDelay,
+		},
+		Database: db.Config{
+			MaxOpenConns:    25,
+			MaxIdleConns:    25,
+			ConnMaxLifetime: 5 * time.Minute,
+			ConnMaxIdleTime: time.Minute,
+			ConnectTimeout:  time.Minute,
+
+			StatementTimeout: 5 * time.Second,
+			LockTimeout:      2 * time.Second,
+		},
+		Cache: cache.Config{Enabled: true, ListTTL: 30 * time.Second},
+		Auth: auth.Config{
+			CookieSameSite: auth.SameSiteLax,
+			OIDC:           auth.OIDCConfig{ProviderName: "oidc"},
+			Local:          auth.LocalConfig{PasswordHashAlgorithm: auth.HashArgon2id},
+		},
+		RateLimit:   ratelimit.DefaultConfig,
+		CORS:        cors.DefaultConfig,
+		Circulation: circulation.DefaultPolicy,
+		Idempotency: IdempotencyConfig{KeyTTL: idempotency.DefaultTTL, CleanupInterval: idempotency.DefaultCleanupInterval},
+		Jobs: JobsConfig{
+			SoftDeleteRetention: jobs.DefaultRetention,
+			PurgeInterval:       jobs.DefaultPurgeInterval,
+		},
+		Tracing: tracing.Config{
+			Exporter:    tracing.ExporterNone,
+			File:        "traces.jsonl",
+			SampleRatio: 1,
+			ServiceName: tracing.Name,
+		},
+		Log: logging.Config{Level: "info", Format: logging.FormatJSON},
+	}
+}
+
+// Load builds the configuration from the defaults, the file named by -config
+// or CONFIG_FILE, the environment and args, which are the command-line
+// arguments without the program name. It reports malformed values but does
+// not call Validate. With -h it returns flag.ErrHelp after printing usage.
+func Load(args []string) (*Config, error) {
+	c := Default()
+	settings := c.settings()
+
+	fs := flag.NewFlagSet(filepath.Base(os.Args[0]), flag.ContinueOnError)
+	fs.StringVar(&c.File, "config", os.Getenv("CONFIG_FILE"), "YAML or TOML config file (env CONFIG_FILE)")
+	fs.BoolVar(&c.PrintConfig, "print-config", false, "print the effective configuration with secrets redacted and exit")
+	fromFlags := map[string]string{}
+	for _, s := range settings {
+		key := s.key
+		fs.Func(key, fmt.Sprintf("%s (env %s)", s.usage, s.env), func(v string) error {
+			fromFlags[key] = v
+			return nil
+		})
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	c.Args = fs.Args()
+
+	set := map[string]bool{}
+	apply := func(source string, s setting, v string) error {
+		if err := s.value.Set(v); err != nil {
+			return fmt.Errorf("%s: invalid value %q for %s: %v", source, v, s.key, err)
+		}
+		set[s.key] = true
+		return nil
+	}
+
+	if c.File != "" {
+		values, err := readFile(c.File)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range settings {
+			if v, ok := values[s.key]; ok {
+				if err := apply(c.File, s, v); err != nil {
+					return nil, err
+				}
+				delete(values, s.key)
+			}
+		}
+		for key := range values {
+			return nil, fmt.Errorf("%s: unknown setting %s", c.File, key)
+		}
+	}
+	for _, s := range settings {
+		if v, ok := os.LookupEnv(s.env); ok && v != "" {
+			if err := apply(s.env, s, v); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, s := range settings {
+		if v, ok := fromFlags[s.key]; ok {
+			if err := apply("flag -"+s.key, s, v); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Values derived from others unless configured explicitly
+	c.Auth.BaseURL = strings.TrimSuffix(c.Auth.BaseURL, "/")
+	if c.Auth.BaseURL == "" {
+		c.Auth.BaseURL = fmt.Sprintf("http://localhost:%d", c.Server.Port)
+	}
+	production := c.Server.Environment == EnvProduction
+	if !set["server.graphiql"] {
+		c.Server.GraphiQL = !production
+	}
+	if !set["server.introspection"] {
+		c.Server.Introspection = !production
+	}
+	if !set["server.pretty_json"] {
+		c.Server.PrettyJSON = !production
+	}
+	if !set["auth.cookie_secure"] {
+		c.Auth.CookieSecure = strings.HasPrefix(c.Auth.BaseURL, "https://")
+	}
+	for i, origin := range c.Auth.RedirectAllowlist {
+		c.Auth.RedirectAllowlist[i] = strings.TrimSuffix(origin, "/")
+	}
+	for i, origin := range c.CORS.AllowedOrigins {
+		c.CORS.AllowedOrigins[i] = strings.TrimSuffix(origin, "/")
+	}
+	return c, nil
+}
+
+// readFile flattens a YAML or TOML file into dotted keys, e.g. server.port.
+// Lists become comma-separated values.
+func readFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]interface{}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &doc)
+	case ".toml":
+		err = toml.Unmarshal(data, &doc)
+	default:
+		return nil, fmt.Errorf("%s: unsupported config file type %q, use .yaml, .yml or .toml", path, ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	values := map[string]string{}
+	var flatten func(prefix string, v interface{})
+	flatten = func(prefix string, v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			for k, child := range v {
+				flatten(prefix+k+".", child)
+			}
+		case []interface{}:
+			items := make([]string, len(v))
+			for i, item := range v {
+				items[i] = fmt.Sprint(item)
+			}
+			values[strings.TrimSuffix(prefix, ".")] = strings.Join(items, ",")
+		case nil:
+		default:
+			values[strings.TrimSuffix(prefix, ".")] = fmt.Sprint(v)
+		}
+	}
+	flatten("", doc)
+	return values, nil
+}
+
+// Validate checks the configuration the server needs, reporting every problem at once
+func (c *Config) Validate() error {
+	errs := []error{c.ValidateDatabase()}
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Server.Port > 0 && c.Server.Port <= 65535, "server.port: %d is not a valid port", c.Server.Port)
+	check(c.Server.Environment == EnvDevelopment || c.Server.Environment == EnvProduction, "server.environment: %q is not %s or %s", c.Server.Environment, EnvDevelopment, EnvProduction)
+	if c.Admin.Addr != "" {
+		_, _, err := net.SplitHostPort(c.Admin.Addr)
+		check(err == nil, "admin.addr: %q is not a host:port address", c.Admin.Addr)
+	}
+	check(c.Server.ReadTimeout > 0 && c.Server.ReadHeaderTimeout > 0 && c.Server.WriteTimeout > 0 && c.Server.IdleTimeout > 0,
+		"server.read_timeout, server.read_header_timeout, server.write_timeout and server.idle_timeout must be positive")
+	check(c.Server.MaxHeaderBytes >= 4096, "server.max_header_bytes must be at least 4096")
+	check(c.Server.DrainDelay >= 0, "server.drain_delay must not be negative")
+	check(c.Server.ShutdownTimeout > 0, "server.shutdown_timeout must be positive")
+	check(c.Server.HealthTimeout > 0, "server.health_timeout must be positive")
+	check(c.Server.ResolverTimeout >= 0, "server.resolver_timeout must not be negative")
+	check(c.Server.ResolverTimeout < c.Server.WriteTimeout, "server.resolver_timeout must be shorter than server.write_timeout, or clients never see the timeout error")
+
+	check(c.Auth.JWTSecret != "", "auth.jwt_secret (JWT_SECRET) is required")
+	check(isOrigin(c.Auth.BaseURL, true), "auth.base_url: %q is not an http(s) URL", c.Auth.BaseURL)
+	for _, origin := range c.Auth.RedirectAllowlist {
+		check(isOrigin(origin, false), "auth.redirect_allowlist: %q is not an origin such as https://app.example.com", origin)
+	}
+	if c.Auth.Google.ClientID != "" {
+		check(c.Auth.Google.ClientSecret != "", "auth.google.client_secret is required with auth.google.client_id")
+		check(c.Auth.Google.RedirectURL == "" || isOrigin(c.Auth.Google.RedirectURL, true), "auth.google.redirect_url: %q is not an http(s) URL", c.Auth.Google.RedirectURL)
+	}
+	if oidc := c.Auth.OIDC; oidc.IssuerURL != "" {
+		check(isOrigin(oidc.IssuerURL, true), "auth.oidc.issuer_url: %q is not an http(s) URL", oidc.IssuerURL)
+		check(oidc.ClientID != "", "auth.oidc.client_id is required with auth.oidc.issuer_url")
+		check(oidc.ProviderName != "", "auth.oidc.provider_name must not be empty")
+		check(oidc.RedirectURL == "" || isOrigin(oidc.RedirectURL, true), "auth.oidc.redirect_url: %q is not an http(s) URL", oidc.RedirectURL)
+	}
+	if c.Auth.Local.Enabled {
+		alg := c.Auth.Local.PasswordHashAlgorithm
+		check(alg == auth.HashArgon2id || alg == auth.HashBcrypt, "auth.local.password_hash_algorithm: %q is not %s or %s", alg, auth.HashArgon2id, auth.HashBcrypt)
+	}
+
+	for _, origin := range c.CORS.AllowedOrigins {
+		check(origin == "*" || isOrigin(origin, false), "cors.allowed_origins: %q is not an origin such as https://app.example.com", origin)
+		check(origin != "*" || !c.CORS.AllowCredentials, "cors.allowed_origins: * cannot be combined with cors.allow_credentials; list the origins")
+	}
+	check(c.CORS.MaxAge >= 0, "cors.max_age must not be negative")
+
+	switch c.Auth.CookieSameSite {
+	case auth.SameSiteLax, auth.SameSiteStrict:
+	case auth.SameSiteNone:
+		// Browsers drop SameSite=None cookies without Secure, and only a
+		// cross-site front-end sending credentials needs them
+		check(c.Auth.CookieSecure, "auth.cookie_samesite: none requires auth.cookie_secure")
+		check(c.CORS.AllowCredentials, "auth.cookie_samesite: none is only needed with cors.allow_credentials")
+	default:
+		check(false, "auth.cookie_samesite: %q is not %s, %s or %s", c.Auth.CookieSameSite, auth.SameSiteLax, auth.SameSiteStrict, auth.SameSiteNone)
+	}
+
+	check(c.Transactions.MaxAttempts >= 1, "database.tx_max_attempts must be at least 1")
+	check(c.Transactions.RetryDelay >= 0, "database.tx_retry_delay must not be negative")
+	check(c.Server.CompressMinSize >= 0, "server.compress_min_size must not be negative")
+	check(c.Server.TrustedProxies >= 0, "server.trusted_proxies must not be negative")
+	check(!c.Cache.Enabled || c.Cache.ListTTL > 0, "cache.list_ttl must be positive")
+	check(c.Circulation.LoanPeriod > 0, "circulation.loan_period must be positive")
+	check(c.Circulation.MaxRenewals >= 0, "circulation.max_renewals must not be negative")
+	check(c.Circulation.MaxLoans >= 0, "circulation.max_loans must not be negative")
+	check(c.Idempotency.KeyTTL > 0, "idempotency.key_ttl must be positive")
+	check(c.Idempotency.CleanupInterval > 0, "idempotency.cleanup_interval must be positive")
+	check(c.Jobs.SoftDeleteRetention > 0, "jobs.soft_delete_retention must be positive")
+	check(c.Jobs.PurgeInterval > 0, "jobs.purge_interval must be positive")
+
+	switch c.Tracing.Exporter {
+	case tracing.ExporterNone, tracing.ExporterOTLP, tracing.ExporterStdout:
+	case tracing.ExporterFile:
+		check(c.Tracing.File != "", "tracing.file is required with the file exporter")
+	default:
+		errs = append(errs, fmt.Errorf("tracing.exporter: %q is not none, otlp, stdout or file", c.Tracing.Exporter))
+	}
+	check(c.Tracing.OTLPEndpoint == "" || isOrigin(c.Tracing.OTLPEndpoint, true), "tracing.otlp_endpoint: %q is not an http(s) URL", c.Tracing.OTLPEndpoint)
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "tracing.sample_ratio must be between 0 and 1")
+	check(c.Tracing.ServiceName != "", "tracing.service_name must not be empty")
+
+	if _, err := logging.ParseLevel(c.Log.Level); err != nil {
+		errs = append(errs, fmt.Errorf("log.level: %q is not debug, info, warn or error", c.Log.Level))
+	}
+	check(c.Log.Format == logging.FormatJSON || c.Log.Format == logging.FormatText, "log.format: %q is not json or text", c.Log.Format)
+	return errors.Join(errs...)
+}
+
+// ValidateDatabase checks only the database settings, for tools that need nothing else
+func (c *Config) ValidateDatabase() error {
+	var errs []error
+	if c.Database.DSN == "" {
+		errs = append(errs, errors.New("database.dsn (DB_CONNECTION_STRING) is required"))
+	}
+	if c.Database.MaxOpenConns < 0 || c.Database.MaxIdleConns < 0 {
+		errs = append(errs, errors.New("database.max_open_conns and database.max_idle_conns must not be negative"))
+	}
+	if c.Database.ConnMaxLifetime < 0 || c.Database.ConnMaxIdleTime < 0 {
+		errs = append(errs, errors.New("database.conn_max_lifetime and database.conn_max_idle_time must not be negative"))
+	}
+	if c.Database.ConnectTimeout < 0 {
+		errs = append(errs, errors.New("database.connect_timeout must not be negative"))
+	}
+	if c.Database.StatementTimeout < 0 || c.Database.LockTimeout < 0 {
+		errs = append(errs, errors.New("database.statement_timeout and database.lock_timeout must not be negative"))
+	}
+	return errors.Join(errs...)
+}
+
+// isOrigin reports whether s is an absolute http(s) URL, with a path only if allowPath
+func isOrigin(s string, allowPath bool) bool {
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return false
+	}
+	return allowPath || (u.Path == "" && u.RawQuery == "")
+}
+
+// String lists the effective configuration, one key = value per line, with secrets redacted
+func (c *Config) String() string {
+	var b strings.Builder
+	if c.File != "" {
+		fmt.Fprintf(&b, "# from %s\n", c.File)
+	}
+	for _, s := range c.settings() {
+		v := s.value.String()
+		if s.redact != nil {
+			v = s.redact(v)
+		}
+		fmt.Fprintf(&b, "%s = %s\n", s.key, v)
+	}
+	return b.String()
+}
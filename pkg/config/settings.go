@@ -0,0 +1,240 @@
+package config
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"library-system/pkg/ratelimit"
+)
+
+// setting is one configuration value. key names it in config files and on
+// the command line (-key), env in the environment.
+type setting struct {
+	key    string
+	env    string
+	usage  string
+	value  value
+	redact func(string) string // Applied when printing; nil for values that are safe to show
+}
+
+// value parses and formats a setting; it is a flag.Value
+type value interface {
+	Set(s string) error
+	String() string
+}
+
+// settings lists every value that can be configured, bound to c
+func (c *Config) settings() []setting {
+	return []setting{
+		{key: "server.port", env: "PORT", usage: "HTTP port", value: (*intValue)(&c.Server.Port)},
+		{key: "server.environment", env: "ENVIRONMENT", usage: "development or production", value: (*stringValue)(&c.Server.Environment)},
+		{key: "server.graphiql", env: "GRAPHIQL_ENABLED", usage: "serve GraphiQL on the public /graphql endpoint (default: not production)", value: (*boolValue)(&c.Server.GraphiQL)},
+		{key: "server.introspection", env: "GRAPHQL_INTROSPECTION", usage: "answer schema introspection on the public endpoint (default: not production)", value: (*boolValue)(&c.Server.Introspection)},
+		{key: "server.pretty_json", env: "GRAPHQL_PRETTY", usage: "indent GraphQL responses (default: not production)", value: (*boolValue)(&c.Server.PrettyJSON)},
+		{key: "server.compression", env: "HTTP_COMPRESSION", usage: "compress responses with brotli or gzip when the client accepts it", value: (*boolValue)(&c.Server.Compression)},
+		{key: "server.compress_min_size", env: "HTTP_COMPRESS_MIN_SIZE", usage: "smallest response in bytes that is compressed", value: (*intValue)(&c.Server.CompressMinSize)},
+		{key: "server.trusted_proxies", env: "TRUSTED_PROXIES", usage: "reverse proxies appending to X-Forwarded-For in front of the server, 0 to ignore the header", value: (*intValue)(&c.Server.TrustedProxies)},
+		{key: "server.migrate_on_boot", env: "MIGRATE_ON_BOOT", usage: "apply pending database migrations before serving", value: (*boolValue)(&c.Server.MigrateOnBoot)},
+		{key: "server.read_timeout", env: "SERVER_READ_TIMEOUT", usage: "maximum time to read a request, including the body", value: (*durationValue)(&c.Server.ReadTimeout)},
+		{key: "server.read_header_timeout", env: "SERVER_READ_HEADER_TIMEOUT", usage: "maximum time to read request headers", value: (*durationValue)(&c.Server.ReadHeaderTimeout)},
+		{key: "server.write_timeout", env: "SERVER_WRITE_TIMEOUT", usage: "maximum time to write a response", value: (*durationValue)(&c.Server.WriteTimeout)},
+		{key: "server.idle_timeout", env: "SERVER_IDLE_TIMEOUT", usage: "how long idle keep-alive connections are kept", value: (*durationValue)(&c.Server.IdleTimeout)},
+		{key: "server.max_header_bytes", env: "SERVER_MAX_HEADER_BYTES", usage: "maximum size of request headers", value: (*intValue)(&c.Server.MaxHeaderBytes)},
+		{key: "server.drain_delay", env: "SERVER_DRAIN_DELAY", usage: "time between reporting not ready and draining connections on shutdown", value: (*durationValue)(&c.Server.DrainDelay)},
+		{key: "server.shutdown_timeout", env: "SERVER_SHUTDOWN_TIMEOUT", usage: "deadline for in-flight requests on shutdown", value: (*durationValue)(&c.Server.ShutdownTimeout)},
+		{key: "server.health_timeout", env: "HEALTH_CHECK_TIMEOUT", usage: "deadline for the readiness checks", value: (*durationValue)(&c.Server.HealthTimeout)},
+		{key: "server.resolver_timeout", env: "GRAPHQL_RESOLVER_TIMEOUT", usage: "deadline for each top-level GraphQL field, 0 to disable", value: (*durationValue)(&c.Server.ResolverTimeout)},
+
+		{key: "admin.addr", env: "ADMIN_ADDR", usage: "internal listener for pprof, expvar and GraphiQL; empty disables it", value: (*stringValue)(&c.Admin.Addr)},
+
+		{key: "database.dsn", env: "DB_CONNECTION_STRING", usage: "Postgres connection string", value: (*stringValue)(&c.Database.DSN), redact: redactDSN},
+		{key: "database.replica_dsn", env: "DB_REPLICA_CONNECTION_STRING", usage: "optional read replica for list and count queries", value: (*stringValue)(&c.Database.ReplicaDSN), redact: redactDSN},
+		{key: "database.max_open_conns", env: "DB_MAX_OPEN_CONNS", usage: "maximum open connections per pool", value: (*intValue)(&c.Database.MaxOpenConns)},
+		{key: "database.max_idle_conns", env: "DB_MAX_IDLE_CONNS", usage: "maximum idle connections per pool", value: (*intValue)(&c.Database.MaxIdleConns)},
+		{key: "database.conn_max_lifetime", env: "DB_CONN_MAX_LIFETIME", usage: "how long a connection can be reused", value: (*durationValue)(&c.Database.ConnMaxLifetime)},
+		{key: "database.conn_max_idle_time", env: "DB_CONN_MAX_IDLE_TIME", usage: "how long an idle connection is kept, 0 for no limit", value: (*durationValue)(&c.Database.ConnMaxIdleTime)},
+		{key: "database.connect_timeout", env: "DB_CONNECT_TIMEOUT", usage: "how long to keep retrying an unreachable database at startup", value: (*durationValue)(&c.Database.ConnectTimeout)},
+		{key: "database.statement_timeout", env: "DB_STATEMENT_TIMEOUT", usage: "Postgres statement_timeout for every session, 0 to disable", value: (*durationValue)(&c.Database.StatementTimeout)},
+		{key: "database.lock_timeout", env: "DB_LOCK_TIMEOUT", usage: "Postgres lock_timeout for every session, 0 to disable", value: (*durationValue)(&c.Database.LockTimeout)},
+		{key: "database.isolation", env: "DB_ISOLATION", usage: "transaction isolation: read_committed, repeatable_read or serializable", value: (*isolationValue)(&c.Transactions.Isolation)},
+		{key: "database.tx_max_attempts", env: "DB_TX_MAX_ATTEMPTS", usage: "runs of a transaction hitting serialization failures or deadlocks, 1 to disable retries", value: (*intValue)(&c.Transactions.MaxAttempts)},
+		{key: "database.tx_retry_delay", env: "DB_TX_RETRY_DELAY", usage: "upper bound of the random delay before the first retry, doubling per retry", value: (*durationValue)(&c.Transactions.RetryDelay)},
+
+		{key: "cache.enabled", env: "CACHE_ENABLED", usage: "cache the book lists in process", value: (*boolValue)(&c.Cache.Enabled)},
+		{key: "cache.list_ttl", env: "CACHE_LIST_TTL", usage: "how long a book list is cached", value: (*durationValue)(&c.Cache.ListTTL)},
+
+		{key: "auth.jwt_secret", env: "JWT_SECRET", usage: "key for signing session tokens", value: (*stringValue)(&c.Auth.JWTSecret), redact: redactSecret},
+		{key: "auth.base_url", env: "AUTH_BASE_URL", usage: "externally visible address of this server (default http://localhost:<port>)", value: (*stringValue)(&c.Auth.BaseURL)},
+		{key: "auth.cookie_secure", env: "COOKIE_SECURE", usage: "mark auth cookies as HTTPS-only (default: base URL is https)", value: (*boolValue)(&c.Auth.CookieSecure)},
+		{key: "auth.cookie_samesite", env: "COOKIE_SAMESITE", usage: "SameSite of the session cookie: lax, strict or none", value: (*stringValue)(&c.Auth.CookieSameSite)},
+		{key: "auth.redirect_allowlist", env: "AUTH_REDIRECT_ALLOWLIST", usage: "comma-separated origins allowed as post-login redirect targets", value: (*listValue)(&c.Auth.RedirectAllowlist)},
+		{key: "auth.google.client_id", env: "GOOGLE_CLIENT_ID", usage: "enables Google sign-in", value: (*stringValue)(&c.Auth.Google.ClientID)},
+		{key: "auth.google.client_secret", env: "GOOGLE_CLIENT_SECRET", usage: "Google OAuth client secret", value: (*stringValue)(&c.Auth.Google.ClientSecret), redact: redactSecret},
+		{key: "auth.google.redirect_url", env: "GOOGLE_REDIRECT_URL", usage: "Google OAuth callback (default under the base URL)", value: (*stringValue)(&c.Auth.Google.RedirectURL)},
+		{key: "auth.oidc.provider_name", env: "OIDC_PROVIDER_NAME", usage: "name of the OIDC provider in login URLs", value: (*stringValue)(&c.Auth.OIDC.ProviderName)},
+		{key: "auth.oidc.issuer_url", env: "OIDC_ISSUER_URL", usage: "enables a generic OpenID Connect provider", value: (*stringValue)(&c.Auth.OIDC.IssuerURL)},
+		{key: "auth.oidc.client_id", env: "OIDC_CLIENT_ID", usage: "OIDC client ID", value: (*stringValue)(&c.Auth.OIDC.ClientID)},
+		{key: "auth.oidc.client_secret", env: "OIDC_CLIENT_SECRET", usage: "OIDC client secret", value: (*stringValue)(&c.Auth.OIDC.ClientSecret), redact: redactSecret},
+		{key: "auth.oidc.redirect_url", env: "OIDC_REDIRECT_URL", usage: "OIDC callback (default under the base URL)", value: (*stringValue)(&c.Auth.OIDC.RedirectURL)},
+		{key: "auth.oidc.scopes", env: "OIDC_SCOPES", usage: "comma-separated extra OIDC scopes", value: (*listValue)(&c.Auth.OIDC.Scopes)},
+		{key: "auth.local.enabled", env: "LOCAL_AUTH_ENABLED", usage: "enable email/password accounts", value: (*boolValue)(&c.Auth.Local.Enabled)},
+		{key: "auth.local.password_hash_algorithm", env: "PASSWORD_HASH_ALGORITHM", usage: "argon2id or bcrypt", value: (*stringValue)(&c.Auth.Local.PasswordHashAlgorithm)},
+
+		{key: "rate_limit.default", env: "RATE_LIMIT_DEFAULT", usage: "budget for API traffic, e.g. 300/m", value: (*limitValue)(&c.RateLimit.Default)},
+		{key: "rate_limit.mutation", env: "RATE_LIMIT_MUTATION", usage: "budget for GraphQL mutations", value: (*limitValue)(&c.RateLimit.Mutation)},
+		{key: "rate_limit.auth", env: "RATE_LIMIT_AUTH", usage: "budget for login endpoints", value: (*limitValue)(&c.RateLimit.Auth)},
+		{key: "rate_limit.ip", env: "RATE_LIMIT_IP", usage: "budget per client IP, checked before authentication", value: (*limitValue)(&c.RateLimit.IP)},
+
+		{key: "cors.allowed_origins", env: "CORS_ALLOWED_ORIGINS", usage: "comma-separated origins of browser front-ends, or * for any without credentials; empty disables CORS", value: (*listValue)(&c.CORS.AllowedOrigins)},
+		{key: "cors.allowed_methods", env: "CORS_ALLOWED_METHODS", usage: "methods cross-origin requests may use", value: (*listValue)(&c.CORS.AllowedMethods)},
+		{key: "cors.allowed_headers", env: "CORS_ALLOWED_HEADERS", usage: "request headers cross-origin requests may send", value: (*listValue)(&c.CORS.AllowedHeaders)},
+		{key: "cors.exposed_headers", env: "CORS_EXPOSED_HEADERS", usage: "response headers front-end scripts may read", value: (*listValue)(&c.CORS.ExposedHeaders)},
+		{key: "cors.allow_credentials", env: "CORS_ALLOW_CREDENTIALS", usage: "let cross-origin requests carry the session cookie", value: (*boolValue)(&c.CORS.AllowCredentials)},
+		{key: "cors.max_age", env: "CORS_MAX_AGE", usage: "how long browsers may cache a preflight response", value: (*durationValue)(&c.CORS.MaxAge)},
+
+		{key: "circulation.loan_period", env: "LOAN_PERIOD", usage: "time until a new loan is due", value: (*durationValue)(&c.Circulation.LoanPeriod)},
+		{key: "circulation.max_renewals", env: "MAX_RENEWALS", usage: "renewals allowed per loan", value: (*intValue)(&c.Circulation.MaxRenewals)},
+		{key: "circulation.max_loans", env: "MAX_LOANS", usage: "active loans allowed per member, 0 for no limit", value: (*intValue)(&c.Circulation.MaxLoans)},
+
+		{key: "idempotency.key_ttl", env: "IDEMPOTENCY_KEY_TTL", usage: "how long idempotent responses are replayed", value: (*durationValue)(&c.Idempotency.KeyTTL)},
+		{key: "idempotency.cleanup_interval", env: "IDEMPOTENCY_CLEANUP_INTERVAL", usage: "how often expired idempotency keys are deleted", value: (*durationValue)(&c.Idempotency.CleanupInterval)},
+
+		{key: "jobs.soft_delete_retention", env: "SOFT_DELETE_RETENTION", usage: "how long soft-deleted rows are kept", value: (*durationValue)(&c.Jobs.SoftDeleteRetention)},
+		{key: "jobs.purge_interval", env: "PURGE_INTERVAL", usage: "how often soft-deleted rows are purged", value: (*durationValue)(&c.Jobs.PurgeInterval)},
+
+		{key: "tracing.exporter", env: "TRACING_EXPORTER", usage: "where spans go: none, otlp, stdout or file", value: (*stringValue)(&c.Tracing.Exporter)},
+		{key: "tracing.otlp_endpoint", env: "TRACING_OTLP_ENDPOINT", usage: "OTLP/HTTP collector URL (default from OTEL_EXPORTER_OTLP_ENDPOINT)", value: (*stringValue)(&c.Tracing.OTLPEndpoint)},
+		{key: "tracing.file", env: "TRACING_FILE", usage: "output of the file exporter", value: (*stringValue)(&c.Tracing.File)},
+		{key: "tracing.sample_ratio", env: "TRACING_SAMPLE_RATIO", usage: "fraction of new traces recorded", value: (*floatValue)(&c.Tracing.SampleRatio)},
+		{key: "tracing.service_name", env: "TRACING_SERVICE_NAME", usage: "service.name reported with every span", value: (*stringValue)(&c.Tracing.ServiceName)},
+
+		{key: "log.level", env: "LOG_LEVEL", usage: "least severe level logged: debug, info, warn or error", value: (*stringValue)(&c.Log.Level)},
+		{key: "log.format", env: "LOG_FORMAT", usage: "json, or text for local runs", value: (*stringValue)(&c.Log.Format)},
+	}
+}
+
+type stringValue string
+
+func (v *stringValue) Set(s string) error { *v = stringValue(s); return nil }
+func (v *stringValue) String() string     { return string(*v) }
+
+type intValue int
+
+func (v *intValue) Set(s string) error {
+	n, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil {
+		return err
+	}
+	*v = intValue(n)
+	return nil
+}
+func (v *intValue) String() string { return strconv.Itoa(int(*v)) }
+
+type boolValue bool
+
+func (v *boolValue) Set(s string) error {
+	b, err := strconv.ParseBool(strings.TrimSpace(s))
+	if err != nil {
+		return err
+	}
+	*v = boolValue(b)
+	return nil
+}
+func (v *boolValue) String() string { return strconv.FormatBool(bool(*v)) }
+
+type floatValue float64
+
+func (v *floatValue) Set(s string) error {
+	f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil {
+		return err
+	}
+	*v = floatValue(f)
+	return nil
+}
+func (v *floatValue) String() string { return strconv.FormatFloat(float64(*v), 'g', -1, 64) }
+
+// isolationValue names the isolation levels Postgres implements
+type isolationValue sql.IsolationLevel
+
+var isolationNames = map[sql.IsolationLevel]string{
+	sql.LevelReadCommitted:  "read_committed",
+	sql.LevelRepeatableRead: "repeatable_read",
+	sql.LevelSerializable:   "serializable",
+}
+
+func (v *isolationValue) Set(s string) error {
+	for level, name := range isolationNames {
+		if strings.TrimSpace(s) == name {
+			*v = isolationValue(level)
+			return nil
+		}
+	}
+	return fmt.Errorf("not read_committed, repeatable_read or serializable")
+}
+func (v *isolationValue) String() string { return isolationNames[sql.IsolationLevel(*v)] }
+
+type durationValue time.Duration
+
+func (v *durationValue) Set(s string) error {
+	d, err := time.ParseDuration(strings.TrimSpace(s))
+	if err != nil {
+		return err
+	}
+	*v = durationValue(d)
+	return nil
+}
+func (v *durationValue) String() string { return time.Duration(*v).String() }
+
+// listValue is a comma- or space-separated list
+type listValue []string
+
+func (v *listValue) Set(s string) error {
+	*v = strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' || r == '\n' })
+	return nil
+}
+func (v *listValue) String() string { return strings.Join(*v, ",") }
+
+type limitValue ratelimit.Limit
+
+func (v *limitValue) Set(s string) error {
+	l, err := ratelimit.ParseLimit(s)
+	if err != nil {
+		return err
+	}
+	*v = limitValue(l)
+	return nil
+}
+func (v *limitValue) String() string { return ratelimit.Limit(*v).String() }
+
+const redacted = "REDACTED"
+
+func redactSecret(s string) string {
+	if s == "" {
+		return ""
+	}
+	return redacted
+}
+
+var dsnPassword = regexp.MustCompile(`(password\s*=\s*)('(?:[^'\\]|\\.)*'|\S*)`)
+
+// redactDSN hides the password in URL and key=value connection strings
+func redactDSN(dsn string) string {
+	if u, err := url.Parse(dsn); err == nil && u.Scheme != "" {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), redacted)
+		}
+		q := u.Query()
+		if q.Has("password") {
+			q.Set("password", redacted)
+			u.RawQuery = q.Encode()
+		}
+		return u.String()
+	}
+	return dsnPassword.ReplaceAllString(dsn, "${1}"+redacted)
+}
@@ -0,0 +1,139 @@
+// Package cors lets browser front-ends served from other origins call the
+// API. Preflight requests are answered here, before authentication, and
+// responses to allowed origins carry the Access-Control-* headers.
+package cors
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config lists what cross-origin callers may do; see package config for the
+// defaults. CORS is off while AllowedOrigins is empty.
+type Config struct {
+	AllowedOrigins   []string // scheme://host[:port], or * for any origin without credentials
+	AllowedMethods   []string
+	AllowedHeaders   []string // Request headers beyond the CORS-safelisted ones
+	ExposedHeaders   []string // Response headers scripts may read
+	AllowCredentials bool     // Send cookies such as session_token with cross-origin requests
+	MaxAge           time.Duration
+}
+
+// DefaultConfig allows the methods and headers the API uses, for no origin
+var DefaultConfig = Config{
+	AllowedMethods: []string{http.MethodGet, http.MethodPost},
+	AllowedHeaders: []string{"Content-Type", "Authorization", "X-API-Key", "X-CSRF-Token", "Idempotency-Key", "X-Request-ID", "If-None-Match"},
+	ExposedHeaders: []string{"X-Request-ID", "X-Trace-ID", "ETag", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After"},
+	MaxAge:         10 * time.Minute,
+}
+
+// Policy applies a Config
+type Policy struct {
+	cfg           Config
+	anyOrigin     bool
+	origins       map[string]bool
+	methods       map[string]bool
+	headers       map[string]bool // Canonical header names
+	allowMethods  string          // Access-Control-Allow-Methods
+	exposeHeaders string          // Access-Control-Expose-Headers
+	allowHeaders  string          // Access-Control-Allow-Headers
+	maxAge        string
+}
+
+// New returns the Policy for cfg. Origins are compared without a trailing slash.
+func New(cfg Config) *Policy {
+	p := &Policy{
+		cfg:           cfg,
+		origins:       map[string]bool{},
+		methods:       map[string]bool{},
+		headers:       map[string]bool{},
+		allowMethods:  strings.Join(cfg.AllowedMethods, ", "),
+		exposeHeaders: strings.Join(cfg.ExposedHeaders, ", "),
+		allowHeaders:  strings.Join(cfg.AllowedHeaders, ", "),
+		maxAge:        strconv.Itoa(int(cfg.MaxAge.Seconds())),
+	}
+	for _, origin := range cfg.AllowedOrigins {
+		if origin == "*" {
+			p.anyOrigin = true
+		}
+		p.origins[strings.ToLower(strings.TrimSuffix(origin, "/"))] = true
+	}
+	for _, m := range cfg.AllowedMethods {
+		p.methods[strings.ToUpper(m)] = true
+	}
+	for _, h := range cfg.AllowedHeaders {
+		p.headers[http.CanonicalHeaderKey(h)] = true
+	}
+	return p
+}
+
+// Handler answers preflight requests and adds the CORS headers to responses
+// for allowed origins. Wrap the whole router with it: preflights carry no
+// credentials, so they must be answered before AuthMiddleware, and before
+// routes restricted to other methods reply 405.
+func (p *Policy) Handler(next http.Handler) http.Handler {
+	if len(p.origins) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		h := w.Header()
+		if !p.anyOrigin {
+			h.Add("Vary", "Origin")
+		}
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !p.anyOrigin && !p.origins[strings.ToLower(origin)] {
+			if preflight {
+				http.Error(w, "Forbidden: origin not allowed", http.StatusForbidden)
+				return
+			}
+			// The browser withholds the response from the calling script
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if p.anyOrigin {
+			h.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			h.Set("Access-Control-Allow-Origin", origin)
+		}
+		if p.cfg.AllowCredentials {
+			h.Set("Access-Control-Allow-Credentials", "true")
+		}
+		if !preflight {
+			if p.exposeHeaders != "" {
+				h.Set("Access-Control-Expose-Headers", p.exposeHeaders)
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		h.Add("Vary", "Access-Control-Request-Method")
+		h.Add("Vary", "Access-Control-Request-Headers")
+		if !p.methods[strings.ToUpper(r.Header.Get("Access-Control-Request-Method"))] {
+			http.Error(w, "Forbidden: method not allowed for cross-origin requests", http.StatusForbidden)
+			return
+		}
+		for _, name := range strings.Split(r.Header.Get("Access-Control-Request-Headers"), ",") {
+			name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+			if name != "" && !p.headers[name] {
+				http.Error(w, "Forbidden: header "+name+" not allowed for cross-origin requests", http.StatusForbidden)
+				return
+			}
+		}
+		h.Set("Access-Control-Allow-Methods", p.allowMethods)
+		if p.allowHeaders != "" {
+			h.Set("Access-Control-Allow-Headers", p.allowHeaders)
+		}
+		if p.cfg.MaxAge > 0 {
+			h.Set("Access-Control-Max-Age", p.maxAge)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
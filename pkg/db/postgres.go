@@ -1,33 +1,121 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
-	"log"
+	"log/slog"
+	"strconv"
 	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/XSAM/otelsql"
+	"github.com/lib/pq"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
 )
 
+// DB is the primary connection pool
 var DB *sql.DB
 
-func InitDB(connectionString string) {
+// Replica is the read-replica pool, or nil when none is configured
+var Replica *sql.DB
+
+// Config holds the connection settings; see package config for the defaults
+type Config struct {
+	DSN             string
+	ReplicaDSN      string        // Optional read replica for queries outside transactions
+	MaxOpenConns    int           // Max open connections per pool
+	MaxIdleConns    int           // Max idle connections to keep open per pool
+	ConnMaxLifetime time.Duration // How long a connection can be reused
+	ConnMaxIdleTime time.Duration // How long a connection can sit idle; 0 keeps it
+	ConnectTimeout  time.Duration // How long InitDB keeps retrying an unreachable database
+
+	// Enforced by Postgres on every session unless the DSN sets them; 0 disables
+	StatementTimeout time.Duration // Longest a single statement may run
+	LockTimeout      time.Duration // Longest a statement may wait for a row or table lock, e.g. SELECT ... FOR UPDATE
+}
+
+// Delays between connection attempts in InitDB
+const (
+	initialBackoff = 500 * time.Millisecond
+	maxBackoff     = 10 * time.Second
+)
+
+// InitDB opens the primary pool, and the replica pool if configured, and
+// waits until Postgres answers, retrying with exponential backoff for up to
+// cfg.ConnectTimeout
+func InitDB(cfg Config) error {
 	var err error
-	DB, err = sql.Open("postgres", connectionString)
-	if err != nil {
-		log.Fatal("Failed to open connection to database: ", err)
+	if DB, err = open("database", cfg.DSN, cfg, nil); err != nil {
+		return err
+	}
+	if cfg.ReplicaDSN != "" {
+		// Writes sent to the replica by mistake fail instead of waiting for a read-only error from the server
+		Replica, err = open("replica", cfg.ReplicaDSN, cfg, map[string]string{"default_transaction_read_only": "on"})
+		if err != nil {
+			DB.Close()
+			return err
+		}
 	}
+	return nil
+}
 
-	err = DB.Ping()
+// open connects one pool; name labels its log lines and errors
+func open(name, dsn string, cfg Config, runtime map[string]string) (*sql.DB, error) {
+	pqConfig, err := pq.NewConfig(dsn)
 	if err != nil {
-		log.Fatal("Failed to ping database: ", err)
+		return nil, fmt.Errorf("parse %s connection string: %w", name, err)
+	}
+	if pqConfig.Runtime == nil {
+		pqConfig.Runtime = map[string]string{}
+	}
+	setRuntimeTimeout(pqConfig.Runtime, "statement_timeout", cfg.StatementTimeout)
+	setRuntimeTimeout(pqConfig.Runtime, "lock_timeout", cfg.LockTimeout)
+	for k, v := range runtime {
+		pqConfig.Runtime[k] = v
+	}
+	connector, err := pq.NewConnectorConfig(pqConfig)
+	if err != nil {
+		return nil, fmt.Errorf("open connection to %s: %w", name, err)
 	}
 
-	fmt.Println("Connected to the database successfully!")
+	// Every statement becomes a span under the caller's, if ctx carries one
+	pool := otelsql.OpenDB(connector,
+		otelsql.WithAttributes(semconv.DBSystemNamePostgreSQL),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{OmitConnResetSession: true, OmitRows: true}),
+	)
 
 	// Connection Pooling Configuration
 	// Adjust these based on your server resources and traffic
-	DB.SetMaxOpenConns(25)                 // Max open connections to the DB
-	DB.SetMaxIdleConns(25)                 // Max idle connections to keep open
-	DB.SetConnMaxLifetime(5 * time.Minute) // How long a connection can be reused
+	pool.SetMaxOpenConns(cfg.MaxOpenConns)
+	pool.SetMaxIdleConns(cfg.MaxIdleConns)
+	pool.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	pool.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+
+	deadline := time.Now().Add(cfg.ConnectTimeout)
+	for backoff := initialBackoff; ; backoff = min(2*backoff, maxBackoff) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err = pool.PingContext(ctx)
+		cancel()
+		if err == nil {
+			break
+		}
+		if time.Now().Add(backoff).After(deadline) {
+			pool.Close()
+			return nil, fmt.Errorf("ping %s: %w", name, err)
+		}
+		slog.Warn(name+" not reachable, retrying", "backoff", backoff.String(), "error", err)
+		time.Sleep(backoff)
+	}
+
+	slog.Info("connected to the " + name)
+	return pool, nil
+}
+
+// setRuntimeTimeout sends d as the Postgres setting name when the session
+// starts, in milliseconds, unless the connection string already sets it
+func setRuntimeTimeout(runtime map[string]string, name string, d time.Duration) {
+	if _, ok := runtime[name]; ok || d <= 0 {
+		return
+	}
+	runtime[name] = strconv.FormatInt(d.Milliseconds(), 10)
 }
@@ -0,0 +1,167 @@
+package gqlrequest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/visitor"
+	"github.com/graphql-go/handler"
+)
+
+// MaxBodyBytes is the largest GraphQL request body middlewares will buffer
+const MaxBodyBytes = 1 << 20
+
+// Request is a GraphQL request decoded from HTTP, for middlewares that need
+// to look at the operation before the GraphQL handler runs
+type Request struct {
+	Query         string
+	Variables     map[string]interface{}
+	OperationName string
+
+	doc *ast.Document
+}
+
+// Parse decodes the GraphQL request in r the same way the GraphQL handler does.
+// The body is buffered and restored, so the handler can still read it.
+func Parse(r *http.Request) (*Request, error) {
+	var body []byte
+	if r.Body != nil && r.Body != http.NoBody {
+		var err error
+		body, err = io.ReadAll(io.LimitReader(r.Body, MaxBodyBytes+1))
+		r.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if len(body) > MaxBodyBytes {
+			return nil, errors.New("request body too large")
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	// NewRequestOptions consumes the body (and the form), so run it on a copy
+	clone := r.Clone(r.Context())
+	clone.Body = io.NopCloser(bytes.NewReader(body))
+	opts := handler.NewRequestOptions(clone)
+
+	return &Request{
+		Query:         opts.Query,
+		Variables:     opts.Variables,
+		OperationName: opts.OperationName,
+	}, nil
+}
+
+// parsedKey stores the outcome of Middleware's Parse in the request context
+type parsedKey struct{}
+
+type parsed struct {
+	req *Request
+	err error
+}
+
+// Middleware parses the GraphQL request once for the middlewares inside it,
+// which read it with From. A failed parse is recorded too; the GraphQL
+// handler still gets the body and reports the error itself.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, err := Parse(r)
+		ctx := context.WithValue(r.Context(), parsedKey{}, parsed{req: req, err: err})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// From returns the request parsed by Middleware, or parses r when it is not
+// wrapped by Middleware
+func From(r *http.Request) (*Request, error) {
+	if p, ok := r.Context().Value(parsedKey{}).(parsed); ok {
+		return p.req, p.err
+	}
+	return Parse(r)
+}
+
+// Operation returns the operation that will be executed: the one named by
+// OperationName, or the only operation in the document
+func (q *Request) Operation() (*ast.OperationDefinition, error) {
+	if err := q.parse(); err != nil {
+		return nil, err
+	}
+
+	var selected *ast.OperationDefinition
+	for _, def := range q.doc.Definitions {
+		op, ok := def.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+		if q.OperationName == "" {
+			if selected != nil {
+				return nil, errors.New("operationName is required for documents with several operations")
+			}
+			selected = op
+		} else if op.Name != nil && op.Name.Value == q.OperationName {
+			selected = op
+		}
+	}
+	if selected == nil {
+		return nil, errors.New("no matching operation in document")
+	}
+	return selected, nil
+}
+
+// IsMutation reports whether the executed operation is a mutation.
+// Unparseable documents are reported as not being mutations; the GraphQL handler rejects them.
+func (q *Request) IsMutation() bool {
+	op, err := q.Operation()
+	return err == nil && op.Operation == ast.OperationTypeMutation
+}
+
+// Introspects reports whether the document selects __schema or __type
+// anywhere, including in fragments. Unparseable documents do not introspect.
+func (q *Request) Introspects() bool {
+	if err := q.parse(); err != nil {
+		return false
+	}
+	found := false
+	visitor.Visit(q.doc, &visitor.VisitorOptions{
+		Enter: func(p visitor.VisitFuncParams) (string, interface{}) {
+			if f, ok := p.Node.(*ast.Field); ok && f.Name != nil && (f.Name.Value == "__schema" || f.Name.Value == "__type") {
+				found = true
+				return visitor.ActionBreak, nil
+			}
+			return visitor.ActionNoChange, nil
+		},
+	}, nil)
+	return found
+}
+
+// BlockIntrospection rejects GraphQL requests that query the schema, for
+// deployments that should not publish it. __typename stays available.
+func BlockIntrospection(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q, err := From(r)
+		if err != nil {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		if q.Introspects() {
+			http.Error(w, "Forbidden: introspection is disabled", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (q *Request) parse() error {
+	if q.doc != nil {
+		return nil
+	}
+	doc, err := parser.Parse(parser.ParseParams{Source: q.Query})
+	if err != nil {
+		return err
+	}
+	q.doc = doc
+	return nil
+}
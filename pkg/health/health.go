@@ -0,0 +1,136 @@
+// Package health serves the liveness and readiness probes
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Readiness is a flag the server raises once it is serving and lowers when
+// it starts shutting down, so load balancers stop routing to it before
+// connections are drained
+type Readiness struct {
+	ready atomic.Bool
+}
+
+// Set raises or lowers the flag
+func (r *Readiness) Set(ready bool) {
+	r.ready.Store(ready)
+}
+
+// Ready reports whether the flag is raised
+func (r *Readiness) Ready() bool {
+	return r.ready.Load()
+}
+
+// Check is a dependency the server needs to handle requests
+type Check struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+// Checker answers readiness probes by running its checks concurrently
+type Checker struct {
+	readiness *Readiness
+	timeout   time.Duration
+	checks    []Check
+}
+
+// NewChecker creates a checker that is ready while readiness is raised and
+// every check passes within timeout
+func NewChecker(readiness *Readiness, timeout time.Duration) *Checker {
+	return &Checker{readiness: readiness, timeout: timeout}
+}
+
+// Add registers a check; call it before serving
+func (c *Checker) Add(name string, run func(ctx context.Context) error) {
+	c.checks = append(c.checks, Check{Name: name, Run: run})
+}
+
+// Report is the body of a probe response
+type Report struct {
+	Status string                 `json:"status"` // "ok", "ready" or "not ready"
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+// CheckResult is the outcome of one check. Probes are unauthenticated, so
+// the reason for a failure is only logged.
+type CheckResult struct {
+	Status     string `json:"status"` // "ok" or "fail"
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// Run runs every check, logging the errors of failed ones, and reports
+// whether all of them passed
+func (c *Checker) Run(ctx context.Context) (Report, bool) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	report := Report{Status: "ready", Checks: make(map[string]CheckResult, len(c.checks)+1)}
+	serving := CheckResult{Status: "ok"}
+	if !c.readiness.Ready() {
+		serving = CheckResult{Status: "fail"}
+	}
+	report.Checks["server"] = serving
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, check := range c.checks {
+		wg.Add(1)
+		go func(check Check) {
+			defer wg.Done()
+			start := time.Now()
+			result := CheckResult{Status: "ok"}
+			if err := check.Run(ctx); err != nil {
+				slog.WarnContext(ctx, "readiness check failed", "check", check.Name, "error", err)
+				result = CheckResult{Status: "fail"}
+			}
+			result.DurationMS = time.Since(start).Milliseconds()
+			mu.Lock()
+			report.Checks[check.Name] = result
+			mu.Unlock()
+		}(check)
+	}
+	wg.Wait()
+
+	for _, result := range report.Checks {
+		if result.Status != "ok" {
+			report.Status = "not ready"
+			return report, false
+		}
+	}
+	return report, true
+}
+
+// ReadyHandler serves /readyz: 200 when ready and 503 otherwise, with the
+// status of each check in the body
+func (c *Checker) ReadyHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report, ok := c.Run(r.Context())
+		status := http.StatusOK
+		if !ok {
+			status = http.StatusServiceUnavailable
+		}
+		writeReport(w, status, report)
+	})
+}
+
+// LiveHandler serves /healthz: 200 whenever the process can answer at all.
+// It checks no dependencies, so an outage does not get the process restarted.
+func LiveHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeReport(w, http.StatusOK, Report{Status: "ok"})
+	})
+}
+
+func writeReport(w http.ResponseWriter, status int, report Report) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,32 @@
+package httpx
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ClientIP returns the address of the client that sent r through
+// trustedProxies reverse proxies, each appending the address it received the
+// request from to X-Forwarded-For. It takes the entry that many hops from the
+// right, as entries further left are set by the client. 0 ignores the header.
+func ClientIP(r *http.Request, trustedProxies int) string {
+	if trustedProxies > 0 {
+		// Proxies may append to a repeated header instead of the last line
+		var hops []string
+		for _, line := range r.Header.Values("X-Forwarded-For") {
+			hops = append(hops, strings.Split(line, ",")...)
+		}
+		if len(hops) >= trustedProxies {
+			if ip := net.ParseIP(strings.TrimSpace(hops[len(hops)-trustedProxies])); ip != nil {
+				return ip.String()
+			}
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,71 @@
+package httpx
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// RequestIDHeader is honored on incoming requests and echoed on responses
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds client supplied request IDs
+const maxRequestIDLength = 128
+
+type metadata struct {
+	requestID string
+	clientIP  string
+}
+
+type metadataKey struct{}
+
+// RequestMetadata returns a middleware assigning every request an ID
+// (reusing a well-formed X-Request-ID from the client) and recording the
+// client IP as seen through trustedProxies proxies (see ClientIP), so code
+// without access to the *http.Request, such as GraphQL resolvers, can read them
+func RequestMetadata(trustedProxies int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(RequestIDHeader)
+			if !validRequestID(id) {
+				id = newRequestID()
+			}
+			w.Header().Set(RequestIDHeader, id)
+
+			ctx := context.WithValue(r.Context(), metadataKey{}, metadata{requestID: id, clientIP: ClientIP(r, trustedProxies)})
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// RequestIDFrom returns the ID assigned by RequestMetadata, or "" outside a request
+func RequestIDFrom(ctx context.Context) string {
+	m, _ := ctx.Value(metadataKey{}).(metadata)
+	return m.requestID
+}
+
+// ClientIPFrom returns the client IP recorded by RequestMetadata, or "" outside a request
+func ClientIPFrom(ctx context.Context) string {
+	m, _ := ctx.Value(metadataKey{}).(metadata)
+	return m.clientIP
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// validRequestID accepts printable ASCII IDs without spaces, so they are safe to log and store
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
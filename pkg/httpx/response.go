@@ -0,0 +1,39 @@
+package httpx
+
+import "net/http"
+
+// ResponseRecorder wraps a ResponseWriter to record the status code and
+// body size for middlewares that report on the response
+type ResponseRecorder struct {
+	http.ResponseWriter
+	Status int
+	Size   int64
+}
+
+// NewResponseRecorder wraps w; the status defaults to 200 when the handler never sets one
+func NewResponseRecorder(w http.ResponseWriter) *ResponseRecorder {
+	return &ResponseRecorder{ResponseWriter: w, Status: http.StatusOK}
+}
+
+func (r *ResponseRecorder) WriteHeader(status int) {
+	r.Status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *ResponseRecorder) Write(b []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(b)
+	r.Size += int64(n)
+	return n, err
+}
+
+// Flush supports streaming handlers such as the audit log export
+func (r *ResponseRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap gives http.ResponseController access to the underlying writer
+func (r *ResponseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
@@ -0,0 +1,170 @@
+package idempotency
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"library-system/pkg/auth"
+	"library-system/pkg/jobs"
+	"library-system/pkg/repository"
+)
+
+// HeaderName carries the client's idempotency key; a mutation argument takes precedence
+const HeaderName = "Idempotency-Key"
+
+// Defaults for replaying responses and expiring their keys
+const (
+	DefaultTTL             = 24 * time.Hour
+	DefaultCleanupInterval = time.Hour
+)
+
+// maxKeyLength matches the idempotency_keys.key column
+const maxKeyLength = 255
+
+var (
+	// ErrKeyReused is returned when a key is retried with a different operation or arguments
+	ErrKeyReused = errors.New("idempotency key was already used with different arguments")
+	// ErrInvalidKey is returned for empty, oversized or non-printable keys
+	ErrInvalidKey = errors.New("idempotency key must be 1-255 printable ASCII characters")
+	// ErrUnauthenticated is returned when there is no principal to scope the key to
+	ErrUnauthenticated = errors.New("idempotency keys require an authenticated request")
+)
+
+type headerKey struct{}
+
+// Middleware makes the Idempotency-Key header available to resolvers through KeyFrom
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if key := r.Header.Get(HeaderName); key != "" {
+			r = r.WithContext(context.WithValue(r.Context(), headerKey{}, key))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// KeyFrom returns the Idempotency-Key header of the current request, or ""
+func KeyFrom(ctx context.Context) string {
+	key, _ := ctx.Value(headerKey{}).(string)
+	return key
+}
+
+// Do runs fn in a transaction on store. With a non-empty key, the first
+// successful result for the key and the calling principal is stored in that
+// transaction, and later calls within ttl return it without running fn
+// again. Concurrent calls with the same key wait for the first to finish.
+// Failed calls store nothing, so they can be retried with the same key.
+func Do[T any](ctx context.Context, store repository.Store, ttl time.Duration, key, operation string, args map[string]interface{}, fn func(tx repository.Store) (T, error)) (T, error) {
+	var result T
+	if key == "" {
+		err := store.InTx(ctx, func(tx repository.Store) error {
+			var err error
+			result, err = fn(tx)
+			return err
+		})
+		return result, err
+	}
+
+	if !validKey(key) {
+		return result, ErrInvalidKey
+	}
+	principal, err := principalScope(ctx)
+	if err != nil {
+		return result, err
+	}
+	hash, err := requestHash(operation, args)
+	if err != nil {
+		return result, err
+	}
+
+	err = store.InTx(ctx, func(tx repository.Store) error {
+		rec := repository.IdempotencyRecord{Principal: principal, Key: key, Operation: operation, RequestHash: hash}
+		claimed, err := tx.IdempotencyKeys().Claim(ctx, rec, ttl)
+		if err != nil {
+			return err
+		}
+		if !claimed {
+			result, err = replay[T](ctx, tx, rec)
+			return err
+		}
+
+		if result, err = fn(tx); err != nil {
+			return err
+		}
+		response, err := json.Marshal(result)
+		if err != nil {
+			return fmt.Errorf("failed to encode idempotent response: %w", err)
+		}
+		return tx.IdempotencyKeys().SaveResponse(ctx, principal, key, response)
+	})
+	return result, err
+}
+
+// replay returns the stored response for a live key
+func replay[T any](ctx context.Context, tx repository.Store, rec repository.IdempotencyRecord) (T, error) {
+	var result T
+	stored, err := tx.IdempotencyKeys().Get(ctx, rec.Principal, rec.Key)
+	if err != nil {
+		return result, err
+	}
+	if stored.Operation != rec.Operation || stored.RequestHash != rec.RequestHash {
+		return result, ErrKeyReused
+	}
+	if err := json.Unmarshal(stored.Response, &result); err != nil {
+		return result, fmt.Errorf("failed to decode idempotent response: %w", err)
+	}
+	return result, nil
+}
+
+// principalScope keeps keys from different callers apart
+func principalScope(ctx context.Context) (string, error) {
+	p, ok := auth.PrincipalFrom(ctx)
+	if !ok {
+		return "", ErrUnauthenticated
+	}
+	if p.IsUser() {
+		return "user:" + strconv.Itoa(p.UserID), nil
+	}
+	return "apikey:" + p.TokenID, nil
+}
+
+// requestHash fingerprints the operation and its arguments. encoding/json
+// sorts map keys, so the encoding is stable.
+func requestHash(operation string, args map[string]interface{}) (string, error) {
+	b, err := json.Marshal(args)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(append([]byte(operation+"\n"), b...))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func validKey(key string) bool {
+	if key == "" || len(key) > maxKeyLength {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < ' ' || key[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// CleanupJob deletes expired keys from store every interval
+func CleanupJob(store repository.Store, interval time.Duration) jobs.Job {
+	return jobs.Job{
+		Name:     "expire-idempotency-keys",
+		Interval: interval,
+		Run: func(ctx context.Context) error {
+			_, err := store.IdempotencyKeys().DeleteExpired(ctx)
+			return err
+		},
+	}
+}
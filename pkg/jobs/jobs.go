@@ -0,0 +1,54 @@
+package jobs
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Job is a background task run on a fixed interval
+type Job struct {
+	Name     string
+	Interval time.Duration
+	Run      func(ctx context.Context) error
+}
+
+// Runner runs jobs until its context is cancelled
+type Runner struct {
+	jobs []Job
+	wg   sync.WaitGroup
+}
+
+// Add registers a job; call it before Start
+func (r *Runner) Add(j Job) {
+	r.jobs = append(r.jobs, j)
+}
+
+// Start runs every job once immediately and then on its interval, each in its
+// own goroutine. Errors are logged and the job is retried on the next tick.
+func (r *Runner) Start(ctx context.Context) {
+	for _, j := range r.jobs {
+		r.wg.Add(1)
+		go func(j Job) {
+			defer r.wg.Done()
+			ticker := time.NewTicker(j.Interval)
+			defer ticker.Stop()
+			for {
+				if err := j.Run(ctx); err != nil && ctx.Err() == nil {
+					slog.Error("job failed", "job", j.Name, "error", err)
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+			}
+		}(j)
+	}
+}
+
+// Wait blocks until all jobs have stopped after the context passed to Start is cancelled
+func (r *Runner) Wait() {
+	r.wg.Wait()
+}
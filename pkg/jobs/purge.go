@@ -0,0 +1,55 @@
+package jobs
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"library-system/pkg/audit"
+	"library-system/pkg/repository"
+)
+
+// Defaults for the purge job
+const (
+	DefaultRetention     = 30 * 24 * time.Hour
+	DefaultPurgeInterval = time.Hour
+)
+
+// Purge returns a job that permanently removes books and members soft deleted
+// more than retention ago. Rows still referenced by borrow records are kept so
+// circulation history stays intact.
+func Purge(store repository.Store, retention, interval time.Duration) Job {
+	return Job{
+		Name:     "purge-soft-deleted",
+		Interval: interval,
+		Run: func(ctx context.Context) error {
+			cutoff := time.Now().Add(-retention)
+			return store.InTx(ctx, func(tx repository.Store) error {
+				books, err := tx.Books().PurgeDeleted(ctx, cutoff)
+				if err != nil {
+					return err
+				}
+				for _, b := range books {
+					if err := audit.Record(ctx, tx.AuditLog(), "purgeBook", "book", b.ID, b, nil); err != nil {
+						return err
+					}
+				}
+
+				members, err := tx.Members().PurgeDeleted(ctx, cutoff)
+				if err != nil {
+					return err
+				}
+				for _, m := range members {
+					if err := audit.Record(ctx, tx.AuditLog(), "purgeMember", "member", m.ID, m, nil); err != nil {
+						return err
+					}
+				}
+
+				if len(books) > 0 || len(members) > 0 {
+					slog.Info("purged soft-deleted rows", "books", len(books), "members", len(members))
+				}
+				return nil
+			})
+		},
+	}
+}
@@ -0,0 +1,57 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// GraphQL is a graphql-go extension adding the operation type and name to
+// the request line. Add it with Schema.AddExtensions.
+type GraphQL struct{}
+
+var _ graphql.Extension = GraphQL{}
+
+func (GraphQL) Name() string {
+	return "logging"
+}
+
+func (GraphQL) Init(ctx context.Context, p *graphql.Params) context.Context {
+	return ctx
+}
+
+func (GraphQL) ParseDidStart(ctx context.Context) (context.Context, graphql.ParseFinishFunc) {
+	return ctx, func(error) {}
+}
+
+func (GraphQL) ValidationDidStart(ctx context.Context) (context.Context, graphql.ValidationFinishFunc) {
+	return ctx, func([]gqlerrors.FormattedError) {}
+}
+
+func (GraphQL) ExecutionDidStart(ctx context.Context) (context.Context, graphql.ExecutionFinishFunc) {
+	return ctx, func(*graphql.Result) {}
+}
+
+func (GraphQL) ResolveFieldDidStart(ctx context.Context, info *graphql.ResolveInfo) (context.Context, graphql.ResolveFieldFinishFunc) {
+	if info.Path != nil && info.Path.Prev == nil {
+		if def, ok := info.Operation.(*ast.OperationDefinition); ok {
+			name := "anonymous"
+			if def.Name != nil {
+				name = def.Name.Value
+			}
+			Annotate(ctx, slog.String("operation_type", def.Operation), slog.String("operation", name))
+		}
+	}
+	return ctx, func(interface{}, error) {}
+}
+
+func (GraphQL) HasResult() bool {
+	return false
+}
+
+func (GraphQL) GetResult(context.Context) interface{} {
+	return nil
+}
@@ -0,0 +1,124 @@
+// Package logging configures structured logging with log/slog. Records
+// logged with a request context carry its request and trace IDs, and
+// credentials are redacted before anything is written.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+
+	"library-system/pkg/httpx"
+	"library-system/pkg/tracing"
+)
+
+// Output formats selectable with Config.Format
+const (
+	FormatJSON = "json"
+	FormatText = "text" // key=value lines, easier to read locally
+)
+
+// Config selects the level and format; see package config for the defaults
+type Config struct {
+	Level  string // debug, info, warn or error
+	Format string
+}
+
+// ParseLevel parses a level name such as "info" or "warn"
+func ParseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(s)); err != nil {
+		return 0, fmt.Errorf("unknown log level %q", s)
+	}
+	return level, nil
+}
+
+// Init makes slog.Default write to stdout per cfg. The standard log package
+// then goes through the same handler at level INFO.
+func Init(cfg Config) error {
+	h, err := NewHandler(os.Stdout, cfg)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(slog.New(h))
+	return nil
+}
+
+// NewHandler returns a handler writing to w that adds the request context
+// and redacts credentials
+func NewHandler(w io.Writer, cfg Config) (slog.Handler, error) {
+	level, err := ParseLevel(cfg.Level)
+	if err != nil {
+		return nil, err
+	}
+	opts := &slog.HandlerOptions{Level: level, ReplaceAttr: redactAttr}
+	switch cfg.Format {
+	case FormatJSON, "":
+		return contextHandler{slog.NewJSONHandler(w, opts)}, nil
+	case FormatText:
+		return contextHandler{slog.NewTextHandler(w, opts)}, nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q", cfg.Format)
+	}
+}
+
+// contextHandler adds the request and trace IDs of the record's context
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := httpx.RequestIDFrom(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	if id := tracing.TraceID(ctx); id != "" {
+		r.AddAttrs(slog.String("trace_id", id))
+	}
+	r.Message = redactString(r.Message)
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+const redacted = "REDACTED"
+
+// sensitiveKeys end the names of attributes whose values are never logged
+var sensitiveKeys = []string{"password", "secret", "token", "authorization", "cookie", "api_key", "dsn"}
+
+// sensitiveValues finds credentials embedded in free text such as error messages
+var sensitiveValues = regexp.MustCompile(`(?i)(bearer\s+)\S+|eyJ[\w-]+\.[\w-]+\.[\w-]+|(password\s*=\s*)\S+`)
+
+func redactAttr(groups []string, a slog.Attr) slog.Attr {
+	key := strings.ToLower(a.Key)
+	for _, s := range sensitiveKeys {
+		if strings.HasSuffix(key, s) {
+			return slog.String(a.Key, redacted)
+		}
+	}
+	switch a.Value.Kind() {
+	case slog.KindString:
+		a.Value = slog.StringValue(redactString(a.Value.String()))
+	case slog.KindAny:
+		if err, ok := a.Value.Any().(error); ok {
+			a.Value = slog.StringValue(redactString(err.Error()))
+		}
+	}
+	return a
+}
+
+func redactString(s string) string {
+	return sensitiveValues.ReplaceAllStringFunc(s, func(match string) string {
+		sub := sensitiveValues.FindStringSubmatch(match)
+		return sub[1] + sub[2] + redacted
+	})
+}
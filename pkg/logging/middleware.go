@@ -0,0 +1,84 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"library-system/pkg/httpx"
+
+	"github.com/gorilla/mux"
+)
+
+type requestLogKey struct{}
+
+// requestLog collects attributes that handlers deeper in the chain learn,
+// such as the principal, for the line Middleware writes at the end
+type requestLog struct {
+	mu    sync.Mutex
+	attrs []slog.Attr
+}
+
+// Annotate adds attrs to the request line Middleware logs for ctx,
+// replacing earlier attributes with the same key. Outside Middleware it does
+// nothing.
+func Annotate(ctx context.Context, attrs ...slog.Attr) {
+	rl, ok := ctx.Value(requestLogKey{}).(*requestLog)
+	if !ok {
+		return
+	}
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	for _, a := range attrs {
+		replaced := false
+		for i := range rl.attrs {
+			if rl.attrs[i].Key == a.Key {
+				rl.attrs[i], replaced = a, true
+			}
+		}
+		if !replaced {
+			rl.attrs = append(rl.attrs, a)
+		}
+	}
+}
+
+// Middleware logs one line per request with its status, size and duration,
+// plus whatever handlers added with Annotate. Register it with mux's
+// Router.Use after httpx.RequestMetadata and tracing.Middleware so the line
+// carries their IDs. Server errors are logged at level ERROR.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rl := &requestLog{}
+		ctx := context.WithValue(r.Context(), requestLogKey{}, rl)
+		start := time.Now()
+		rec := httpx.NewResponseRecorder(w)
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+		}
+		if current := mux.CurrentRoute(r); current != nil {
+			if tpl, err := current.GetPathTemplate(); err == nil {
+				attrs = append(attrs, slog.String("route", tpl))
+			}
+		}
+		attrs = append(attrs,
+			slog.Int("status", rec.Status),
+			slog.Int64("size", rec.Size),
+			slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.String("client_ip", httpx.ClientIPFrom(ctx)),
+		)
+		rl.mu.Lock()
+		attrs = append(attrs, rl.attrs...)
+		rl.mu.Unlock()
+
+		level := slog.LevelInfo
+		if rec.Status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		slog.LogAttrs(ctx, level, "request", attrs...)
+	})
+}
@@ -0,0 +1,153 @@
+package metrics
+
+import (
+	"context"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	graphqlDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "graphql_operation_duration_seconds",
+		Help:    "GraphQL execution latency by operation name and type.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"operation", "type"})
+	graphqlResolverDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "graphql_resolver_duration_seconds",
+		Help:    "Latency of top-level GraphQL field resolvers, e.g. RootMutation.borrowBook.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"field"})
+	graphqlErrors = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "graphql_errors_total",
+		Help: "GraphQL errors by extensions.code; errors without a code count as UNCLASSIFIED.",
+	}, []string{"code"})
+)
+
+// Codes for errors raised before execution and for errors without a code
+const (
+	codeParseFailed      = "GRAPHQL_PARSE_FAILED"
+	codeValidationFailed = "GRAPHQL_VALIDATION_FAILED"
+	codeUnclassified     = "UNCLASSIFIED"
+)
+
+// operationNamePattern bounds the operation label to plausible names; clients choose them
+var operationNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,63}$`)
+
+// maxOperationNames caps the distinct operation labels. Clients choose the
+// names, so once the cap is reached unseen names are recorded as "other".
+const maxOperationNames = 100
+
+// operationNames holds the names already used as labels
+var operationNames = struct {
+	sync.Mutex
+	seen map[string]bool
+}{seen: map[string]bool{}}
+
+// operationLabel returns the label for a client-chosen operation name
+func operationLabel(name string) string {
+	if !operationNamePattern.MatchString(name) {
+		return "invalid"
+	}
+	operationNames.Lock()
+	defer operationNames.Unlock()
+	if !operationNames.seen[name] {
+		if len(operationNames.seen) >= maxOperationNames {
+			return "other"
+		}
+		operationNames.seen[name] = true
+	}
+	return name
+}
+
+// GraphQL is a graphql-go extension recording operation and resolver
+// latency and error codes. Add it with Schema.AddExtensions.
+type GraphQL struct{}
+
+var _ graphql.Extension = GraphQL{}
+
+type operationKey struct{}
+
+// operation is filled in while a request executes
+type operation struct {
+	mu   sync.Mutex
+	name string
+	typ  string
+}
+
+func (GraphQL) Name() string {
+	return "metrics"
+}
+
+func (GraphQL) Init(ctx context.Context, p *graphql.Params) context.Context {
+	return context.WithValue(ctx, operationKey{}, &operation{name: "anonymous", typ: "unknown"})
+}
+
+func (GraphQL) ParseDidStart(ctx context.Context) (context.Context, graphql.ParseFinishFunc) {
+	return ctx, func(err error) {
+		if err != nil {
+			graphqlErrors.WithLabelValues(codeParseFailed).Inc()
+		}
+	}
+}
+
+func (GraphQL) ValidationDidStart(ctx context.Context) (context.Context, graphql.ValidationFinishFunc) {
+	return ctx, func(errs []gqlerrors.FormattedError) {
+		if len(errs) > 0 {
+			graphqlErrors.WithLabelValues(codeValidationFailed).Add(float64(len(errs)))
+		}
+	}
+}
+
+func (GraphQL) ExecutionDidStart(ctx context.Context) (context.Context, graphql.ExecutionFinishFunc) {
+	start := time.Now()
+	return ctx, func(result *graphql.Result) {
+		if op, ok := ctx.Value(operationKey{}).(*operation); ok {
+			op.mu.Lock()
+			graphqlDuration.WithLabelValues(op.name, op.typ).Observe(time.Since(start).Seconds())
+			op.mu.Unlock()
+		}
+		for _, e := range result.Errors {
+			code, _ := e.Extensions["code"].(string)
+			if code == "" {
+				code = codeUnclassified
+			}
+			graphqlErrors.WithLabelValues(code).Inc()
+		}
+	}
+}
+
+func (GraphQL) ResolveFieldDidStart(ctx context.Context, info *graphql.ResolveInfo) (context.Context, graphql.ResolveFieldFinishFunc) {
+	// Nested fields use the default resolver; only top-level fields do real work
+	if info.Path == nil || info.Path.Prev != nil {
+		return ctx, func(interface{}, error) {}
+	}
+	if op, ok := ctx.Value(operationKey{}).(*operation); ok {
+		if def, ok := info.Operation.(*ast.OperationDefinition); ok {
+			op.mu.Lock()
+			op.typ = def.Operation
+			if def.Name != nil {
+				op.name = operationLabel(def.Name.Value)
+			}
+			op.mu.Unlock()
+		}
+	}
+	field := info.ParentType.Name() + "." + info.FieldName
+	start := time.Now()
+	return ctx, func(interface{}, error) {
+		graphqlResolverDuration.WithLabelValues(field).Observe(time.Since(start).Seconds())
+	}
+}
+
+func (GraphQL) HasResult() bool {
+	return false
+}
+
+func (GraphQL) GetResult(context.Context) interface{} {
+	return nil
+}
@@ -0,0 +1,129 @@
+// Package metrics exposes Prometheus metrics for HTTP traffic, GraphQL
+// operations, the database pool, circulation and caches
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"library-system/pkg/httpx"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registry holds every metric served by Handler
+var Registry = prometheus.NewRegistry()
+
+var factory = promauto.With(Registry)
+
+var (
+	httpDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "HTTP request latency by route template, method and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+	httpInFlight = factory.NewGauge(prometheus.GaugeOpts{
+		Name: "http_requests_in_flight",
+		Help: "HTTP requests currently being served.",
+	})
+
+	// Circulation counts successful operations, not replays of idempotent retries
+	Borrows = factory.NewCounter(prometheus.CounterOpts{
+		Name: "library_borrows_total",
+		Help: "Books checked out.",
+	})
+	Returns = factory.NewCounter(prometheus.CounterOpts{
+		Name: "library_returns_total",
+		Help: "Books checked in.",
+	})
+	Renewals = factory.NewCounter(prometheus.CounterOpts{
+		Name: "library_renewals_total",
+		Help: "Loans renewed.",
+	})
+
+	// Caches are labelled with the name they were created with, e.g. "catalog";
+	// the hit rate is hits / (hits + misses)
+	CacheRequests = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "library_cache_requests_total",
+		Help: "Cache lookups by cache and result, hit or miss.",
+	}, []string{"cache", "result"})
+	CacheEvictions = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "library_cache_evictions_total",
+		Help: "Live entries dropped to make room for new ones.",
+	}, []string{"cache"})
+	CacheEntries = factory.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "library_cache_entries",
+		Help: "Entries currently cached, including expired ones not yet dropped.",
+	}, []string{"cache"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Handler serves the metrics in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{ErrorHandling: promhttp.ContinueOnError})
+}
+
+// Middleware records latency per route. Register it with mux's Router.Use so
+// the matched route template, not the raw path, becomes the label.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := "unknown"
+		if current := mux.CurrentRoute(r); current != nil {
+			if tpl, err := current.GetPathTemplate(); err == nil {
+				route = tpl
+			}
+		}
+
+		httpInFlight.Inc()
+		defer httpInFlight.Dec()
+		start := time.Now()
+		rec := httpx.NewResponseRecorder(w)
+		next.ServeHTTP(rec, r)
+		httpDuration.WithLabelValues(route, r.Method, strconv.Itoa(rec.Status)).Observe(time.Since(start).Seconds())
+	})
+}
+
+// RegisterDB exports the connection pool statistics of db as <name>_db_*:
+// connections in use and idle, and how often and how long callers waited for one
+func RegisterDB(db *sql.DB, name string) {
+	Registry.MustRegister(collectors.NewDBStatsCollector(db, name))
+}
+
+// RegisterGauge exports a gauge computed by fn on every scrape. A failing fn
+// is reported as a scrape error for this gauge only.
+func RegisterGauge(name, help string, fn func(ctx context.Context) (float64, error)) {
+	Registry.MustRegister(&gaugeFunc{desc: prometheus.NewDesc(name, help, nil, nil), fn: fn})
+}
+
+type gaugeFunc struct {
+	desc *prometheus.Desc
+	fn   func(ctx context.Context) (float64, error)
+}
+
+func (g *gaugeFunc) Describe(ch chan<- *prometheus.Desc) {
+	ch <- g.desc
+}
+
+func (g *gaugeFunc) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	v, err := g.fn(ctx)
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(g.desc, err)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(g.desc, prometheus.GaugeValue, v)
+}
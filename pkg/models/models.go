@@ -3,19 +3,25 @@ package models
 import "time"
 
 type Member struct {
-	ID       int       `json:"id"`
-	Name     string    `json:"name"`
-	Email    string    `json:"email"`
-	JoinedAt time.Time `json:"joined_at"`
+	ID        int        `json:"id"`
+	Name      string     `json:"name"`
+	Email     string     `json:"email"`
+	JoinedAt  time.Time  `json:"joined_at"`
+	Version   int        `json:"version"`              // Incremented on every edit
+	DeletedAt *time.Time `json:"deleted_at,omitempty"` // Set when soft deleted
+	DeletedBy *int       `json:"deleted_by,omitempty"` // User who deleted the member
 }
 
 type Book struct {
-	ID              int    `json:"id"`
-	Title           string `json:"title"`
-	Author          string `json:"author"`
-	PublishedYear   int    `json:"published_year"`
-	TotalCopies     int    `json:"total_copies"`
-	AvailableCopies int    `json:"available_copies"`
+	ID              int        `json:"id"`
+	Title           string     `json:"title"`
+	Author          string     `json:"author"`
+	PublishedYear   int        `json:"published_year"`
+	TotalCopies     int        `json:"total_copies"`
+	AvailableCopies int        `json:"available_copies"`
+	Version         int        `json:"version"`              // Incremented on every edit, not on circulation
+	DeletedAt       *time.Time `json:"deleted_at,omitempty"` // Set when soft deleted
+	DeletedBy       *int       `json:"deleted_by,omitempty"` // User who deleted the book
 }
 
 type Borrow struct {
@@ -23,16 +29,35 @@ type Borrow struct {
 	MemberID   int        `json:"member_id"`
 	BookID     int        `json:"book_id"`
 	BorrowDate time.Time  `json:"borrow_date"`
+	DueDate    time.Time  `json:"due_date"`
 	ReturnDate *time.Time `json:"return_date,omitempty"` // Pointer for nullable time
 	Status     string     `json:"status"`
+	Renewals   int        `json:"renewals"`
 }
 
 type User struct {
 	ID        int       `json:"id"`
 	GoogleID  string    `json:"google_id"`
+	Provider  string    `json:"provider"`            // google, local or a configured OIDC provider name
+	Subject   string    `json:"-"`                   // Stable user ID at the provider
+	MemberID  *int      `json:"member_id,omitempty"` // Library member with the same email, if any
 	Email     string    `json:"email"`
 	Name      string    `json:"name"`
 	AvatarURL string    `json:"avatar_url"`
 	Role      string    `json:"role"` // ADMIN, LIBRARIAN, MEMBER
 	CreatedAt time.Time `json:"created_at"`
 }
+
+// APIKey is a service account credential for machine clients.
+// Only a hash of the key is stored; the key itself is shown once at creation.
+type APIKey struct {
+	ID          int        `json:"id"`
+	Name        string     `json:"name"`
+	Prefix      string     `json:"prefix"`
+	Permissions []string   `json:"permissions"`
+	CreatedBy   *int       `json:"created_by,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty"`
+	LastUsedAt  *time.Time `json:"last_used_at,omitempty"`
+}
@@ -0,0 +1,121 @@
+package ratelimit
+
+import (
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"library-system/pkg/auth"
+	"library-system/pkg/gqlrequest"
+	"library-system/pkg/httpx"
+)
+
+// Default budgets
+var (
+	DefaultLimit  = Limit{Burst: 300, Period: time.Minute}
+	MutationLimit = Limit{Burst: 60, Period: time.Minute}
+	AuthLimit     = Limit{Burst: 20, Period: time.Minute}
+	IPLimit       = Limit{Burst: 1200, Period: time.Minute}
+)
+
+// Config holds the budget for each kind of traffic
+type Config struct {
+	Default  Limit // General API traffic
+	Mutation Limit // GraphQL mutations, counted separately from queries
+	Auth     Limit // Login endpoints
+	IP       Limit // All traffic from one client IP, checked before authentication
+}
+
+// DefaultConfig uses the default budgets
+var DefaultConfig = Config{Default: DefaultLimit, Mutation: MutationLimit, Auth: AuthLimit, IP: IPLimit}
+
+// Limiter throttles requests with token buckets keyed by the authenticated
+// principal, falling back to the client IP that httpx.RequestMetadata
+// recorded for anonymous requests
+type Limiter struct {
+	store Store
+	Config
+}
+
+// New creates a limiter with the given budgets
+func New(store Store, cfg Config) *Limiter {
+	return &Limiter{store: store, Config: cfg}
+}
+
+// Handler limits API traffic. GraphQL mutations use the Mutation budget,
+// everything else the Default budget. Wrap it inside auth.AuthMiddleware so
+// the principal is known.
+func (l *Limiter) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		budget, limit := "default", l.Default
+		if req, err := gqlrequest.From(r); err == nil && req.IsMutation() {
+			budget, limit = "mutation", l.Mutation
+		}
+		l.serve(w, r, next, budget, limit, key(r))
+	})
+}
+
+// IPHandler limits all traffic from a client IP with the IP budget. Wrap
+// auth.AuthMiddleware with it, so anonymous requests and invalid credentials
+// are throttled before they reach the session and API key checks.
+func (l *Limiter) IPHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		l.serve(w, r, next, "ip", l.IP, "ip:"+httpx.ClientIPFrom(r.Context()))
+	})
+}
+
+// AuthHandler limits login endpoints with the Auth budget
+func (l *Limiter) AuthHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		l.serve(w, r, next, "auth", l.Auth, key(r))
+	})
+}
+
+func (l *Limiter) serve(w http.ResponseWriter, r *http.Request, next http.Handler, budget string, limit Limit, caller string) {
+	res, err := l.store.Take(r.Context(), budget+":"+caller, limit)
+	if err != nil {
+		// Fail open: an unavailable store must not take the API down
+		slog.ErrorContext(r.Context(), "rate limit store error", "error", err)
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	h := w.Header()
+	setHeaders(h, res)
+
+	if !res.Allowed {
+		h.Set("Retry-After", strconv.Itoa(ceilSeconds(res.RetryAfter)))
+		http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+		return
+	}
+	next.ServeHTTP(w, r)
+}
+
+// setHeaders reports res in the RateLimit headers. A request can pass an IP
+// and a principal limiter, so the headers describe whichever budget has fewer
+// requests left, and always the budget that rejected the request.
+func setHeaders(h http.Header, res Result) {
+	if prev, err := strconv.Atoi(h.Get("RateLimit-Remaining")); err == nil && prev <= res.Remaining && res.Allowed {
+		return
+	}
+	h.Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+	h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	h.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.ResetAfter)))
+}
+
+// key identifies the caller: the principal if authenticated, otherwise the client IP
+func key(r *http.Request) string {
+	if p, ok := auth.PrincipalFrom(r.Context()); ok {
+		if p.IsUser() {
+			return "user:" + strconv.Itoa(p.UserID)
+		}
+		return "apikey:" + p.TokenID
+	}
+	return "ip:" + httpx.ClientIPFrom(r.Context())
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,155 @@
+package repository
+
+import (
+	"context"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"library-system/pkg/cache"
+	"library-system/pkg/models"
+)
+
+// Cache keys of the catalog
+const (
+	keyBooks        = "books"
+	keyBooksDeleted = "books:deleted"
+)
+
+// CatalogEntries is the number of keys a CachedStore uses, and so the size
+// its cache needs
+const CatalogEntries = 2
+
+// CachedStore is a Store whose book lists outside transactions read through
+// a cache. Book writes, including the availability changes of circulation,
+// drop the lists once their transaction commits.
+// Other instances serving the same database keep their entries until the
+// TTLs pass.
+type CachedStore struct {
+	Store
+	catalog *catalogCache
+	inTx    bool
+}
+
+// catalogCache is shared by a CachedStore and the Stores it binds to transactions
+type catalogCache struct {
+	c   cache.Cache
+	cfg cache.Config
+	// primary loads the entries. A replica lagging behind a write could
+	// otherwise put back the entries its invalidation dropped.
+	primary Store
+	// gen counts invalidations, so a read that raced with one does not store
+	// what it loaded before the write committed
+	gen atomic.Uint64
+}
+
+// NewCachedStore caches the book lists of store in c with the TTL of cfg.
+// Entries are loaded from the primary even if store has a replica.
+func NewCachedStore(store Store, c cache.Cache, cfg cache.Config) *CachedStore {
+	primary := store
+	if pg, ok := store.(*PostgresStore); ok {
+		primary = pg.WithReplica(nil)
+	}
+	return &CachedStore{Store: store, catalog: &catalogCache{c: c, cfg: cfg, primary: primary}}
+}
+
+func (s *CachedStore) Books() BookRepository {
+	return cachedBooks{BookRepository: s.Store.Books(), store: s}
+}
+
+func (s *CachedStore) InTx(ctx context.Context, fn func(tx Store) error) error {
+	return s.Store.InTx(ctx, func(tx Store) error {
+		return fn(&CachedStore{Store: tx, catalog: s.catalog, inTx: true})
+	})
+}
+
+// invalidate drops the lists after the current transaction commits
+func (s *CachedStore) invalidate() {
+	s.Store.OnCommit(func() {
+		s.catalog.gen.Add(1)
+		s.catalog.c.Delete(keyBooks, keyBooksDeleted)
+	})
+}
+
+// readThrough returns the value cached under key, or loads it from the
+// primary and caches it. Inside a transaction it always loads from the
+// transaction, so the transaction sees its own writes.
+func readThrough[T any](s *CachedStore, key string, ttl time.Duration, load func(store Store) (T, error)) (T, error) {
+	if s.inTx {
+		return load(s.Store)
+	}
+	if v, ok := s.catalog.c.Get(key); ok {
+		return v.(T), nil
+	}
+	gen := s.catalog.gen.Load()
+	v, err := load(s.catalog.primary)
+	if err == nil && s.catalog.gen.Load() == gen {
+		s.catalog.c.Set(key, v, ttl)
+	}
+	return v, err
+}
+
+type cachedBooks struct {
+	BookRepository
+	store *CachedStore
+}
+
+func (r cachedBooks) List(ctx context.Context, includeDeleted bool) ([]models.Book, error) {
+	key := keyBooks
+	if includeDeleted {
+		key = keyBooksDeleted
+	}
+	return readThrough(r.store, key, r.store.catalog.cfg.ListTTL, func(store Store) ([]models.Book, error) {
+		books, err := store.Books().List(ctx, includeDeleted)
+		// Callers appending to a shared list must not write into its spare capacity
+		return slices.Clip(books), err
+	})
+}
+
+func (r cachedBooks) Create(ctx context.Context, b models.Book) (models.Book, error) {
+	b, err := r.BookRepository.Create(ctx, b)
+	if err == nil {
+		r.store.invalidate()
+	}
+	return b, err
+}
+
+func (r cachedBooks) Update(ctx context.Context, b models.Book) (models.Book, error) {
+	b, err := r.BookRepository.Update(ctx, b)
+	if err == nil {
+		r.store.invalidate()
+	}
+	return b, err
+}
+
+func (r cachedBooks) AdjustAvailable(ctx context.Context, id, delta int) error {
+	err := r.BookRepository.AdjustAvailable(ctx, id, delta)
+	if err == nil {
+		r.store.invalidate()
+	}
+	return err
+}
+
+func (r cachedBooks) SoftDelete(ctx context.Context, id int, deletedBy *int) (models.Book, error) {
+	b, err := r.BookRepository.SoftDelete(ctx, id, deletedBy)
+	if err == nil {
+		r.store.invalidate()
+	}
+	return b, err
+}
+
+func (r cachedBooks) Restore(ctx context.Context, id int) (models.Book, error) {
+	b, err := r.BookRepository.Restore(ctx, id)
+	if err == nil {
+		r.store.invalidate()
+	}
+	return b, err
+}
+
+func (r cachedBooks) PurgeDeleted(ctx context.Context, cutoff time.Time) ([]models.Book, error) {
+	books, err := r.BookRepository.PurgeDeleted(ctx, cutoff)
+	if err == nil && len(books) > 0 {
+		r.store.invalidate()
+	}
+	return books, err
+}
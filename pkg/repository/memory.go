@@ -0,0 +1,220 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"library-system/pkg/models"
+)
+
+// MemoryStore implements Store in process memory. Transactions are
+// serialized: InTx holds the store's lock and works on a copy of the data
+// that replaces the original when fn succeeds. Inside fn, only use the
+// transactional Store passed to it.
+type MemoryStore struct {
+	mu    *sync.Mutex
+	state *memState
+	inTx  bool
+	now   func() time.Time
+
+	onCommit *[]func() // Hooks of the transaction; nil outside one
+}
+
+type memState struct {
+	books       map[int]models.Book
+	members     map[int]models.Member
+	borrows     map[int]models.Borrow
+	users       map[int]memUser
+	apiKeys     map[int]memAPIKey
+	audit       []AuditEntry
+	idempotency map[[2]string]memIdempotencyRecord
+	lastID      map[string]int
+}
+
+type memUser struct {
+	models.User
+	passwordHash string
+}
+
+type memAPIKey struct {
+	models.APIKey
+	keyHash string
+}
+
+type memIdempotencyRecord struct {
+	IdempotencyRecord
+	expiresAt time.Time
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		mu: &sync.Mutex{},
+		state: &memState{
+			books:       map[int]models.Book{},
+			members:     map[int]models.Member{},
+			borrows:     map[int]models.Borrow{},
+			users:       map[int]memUser{},
+			apiKeys:     map[int]memAPIKey{},
+			idempotency: map[[2]string]memIdempotencyRecord{},
+			lastID:      map[string]int{},
+		},
+		now: memNow,
+	}
+}
+
+// memNow matches the microsecond precision of Postgres timestamps
+func memNow() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+func (s *MemoryStore) Books() BookRepository            { return memBooks{s} }
+func (s *MemoryStore) Members() MemberRepository        { return memMembers{s} }
+func (s *MemoryStore) Borrows() BorrowRepository        { return memBorrows{s} }
+func (s *MemoryStore) Users() UserRepository            { return memUsers{s} }
+func (s *MemoryStore) APIKeys() APIKeyRepository        { return memAPIKeys{s} }
+func (s *MemoryStore) AuditLog() AuditLog               { return memAuditLog{s} }
+func (s *MemoryStore) IdempotencyKeys() IdempotencyKeys { return memIdempotencyKeys{s} }
+
+func (s *MemoryStore) InTx(ctx context.Context, fn func(tx Store) error) error {
+	if s.inTx {
+		return fn(s)
+	}
+	var hooks []func()
+	err := func() error {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		tx := &MemoryStore{mu: s.mu, state: s.state.clone(), inTx: true, now: s.now, onCommit: &hooks}
+		if err := fn(tx); err != nil {
+			return err
+		}
+		s.state = tx.state
+		return nil
+	}()
+	if err != nil {
+		return err
+	}
+	for _, f := range hooks {
+		f()
+	}
+	return nil
+}
+
+func (s *MemoryStore) OnCommit(fn func()) {
+	if s.onCommit == nil {
+		fn()
+		return
+	}
+	*s.onCommit = append(*s.onCommit, fn)
+}
+
+// do runs fn on the data, taking the lock unless a transaction already holds it
+func (s *MemoryStore) do(fn func(st *memState) error) error {
+	if !s.inTx {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+	}
+	return fn(s.state)
+}
+
+func (st *memState) nextID(table string) int {
+	st.lastID[table]++
+	return st.lastID[table]
+}
+
+// clone copies the maps; values are replaced rather than modified in place, so a shallow copy is enough
+func (st *memState) clone() *memState {
+	c := &memState{
+		books:       make(map[int]models.Book, len(st.books)),
+		members:     make(map[int]models.Member, len(st.members)),
+		borrows:     make(map[int]models.Borrow, len(st.borrows)),
+		users:       make(map[int]memUser, len(st.users)),
+		apiKeys:     make(map[int]memAPIKey, len(st.apiKeys)),
+		audit:       append([]AuditEntry(nil), st.audit...),
+		idempotency: make(map[[2]string]memIdempotencyRecord, len(st.idempotency)),
+		lastID:      make(map[string]int, len(st.lastID)),
+	}
+	for k, v := range st.books {
+		c.books[k] = v
+	}
+	for k, v := range st.members {
+		c.members[k] = v
+	}
+	for k, v := range st.borrows {
+		c.borrows[k] = v
+	}
+	for k, v := range st.users {
+		c.users[k] = v
+	}
+	for k, v := range st.apiKeys {
+		c.apiKeys[k] = v
+	}
+	for k, v := range st.idempotency {
+		c.idempotency[k] = v
+	}
+	for k, v := range st.lastID {
+		c.lastID[k] = v
+	}
+	return c
+}
+
+type memIdempotencyKeys struct{ s *MemoryStore }
+
+func (r memIdempotencyKeys) Claim(ctx context.Context, rec IdempotencyRecord, ttl time.Duration) (bool, error) {
+	claimed := false
+	err := r.s.do(func(st *memState) error {
+		now := r.s.now()
+		id := [2]string{rec.Principal, rec.Key}
+		if existing, ok := st.idempotency[id]; ok && existing.expiresAt.After(now) {
+			return nil
+		}
+		rec.Response = nil
+		st.idempotency[id] = memIdempotencyRecord{IdempotencyRecord: rec, expiresAt: now.Add(ttl)}
+		claimed = true
+		return nil
+	})
+	return claimed, err
+}
+
+func (r memIdempotencyKeys) Get(ctx context.Context, principal, key string) (IdempotencyRecord, error) {
+	var rec IdempotencyRecord
+	err := r.s.do(func(st *memState) error {
+		stored, ok := st.idempotency[[2]string{principal, key}]
+		if !ok {
+			return ErrNotFound
+		}
+		rec = stored.IdempotencyRecord
+		return nil
+	})
+	return rec, err
+}
+
+func (r memIdempotencyKeys) SaveResponse(ctx context.Context, principal, key string, response []byte) error {
+	return r.s.do(func(st *memState) error {
+		id := [2]string{principal, key}
+		stored, ok := st.idempotency[id]
+		if !ok {
+			return ErrNotFound
+		}
+		stored.Response = append([]byte(nil), response...)
+		st.idempotency[id] = stored
+		return nil
+	})
+}
+
+func (r memIdempotencyKeys) DeleteExpired(ctx context.Context) (int64, error) {
+	var n int64
+	err := r.s.do(func(st *memState) error {
+		now := r.s.now()
+		for id, rec := range st.idempotency {
+			if !rec.expiresAt.After(now) {
+				delete(st.idempotency, id)
+				n++
+			}
+		}
+		return nil
+	})
+	return n, err
+}
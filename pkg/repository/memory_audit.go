@@ -0,0 +1,82 @@
+package repository
+
+import "context"
+
+type memAuditLog struct{ s *MemoryStore }
+
+func (r memAuditLog) Append(ctx context.Context, rec AuditRecord) error {
+	return r.s.do(func(st *memState) error {
+		st.audit = append(st.audit, AuditEntry{
+			ID:            int64(st.nextID("audit_log")),
+			OccurredAt:    r.s.now(),
+			Actor:         rec.Actor,
+			ActorUserID:   rec.ActorUserID,
+			ActorAPIKeyID: rec.ActorAPIKeyID,
+			Action:        rec.Action,
+			EntityType:    rec.EntityType,
+			EntityID:      rec.EntityID,
+			Before:        rec.Before,
+			After:         rec.After,
+			RequestID:     rec.RequestID,
+			IP:            rec.IP,
+		})
+		return nil
+	})
+}
+
+func (r memAuditLog) List(ctx context.Context, f AuditFilter, beforeID int64, limit int) ([]AuditEntry, error) {
+	var entries []AuditEntry
+	err := r.s.do(func(st *memState) error {
+		for i := len(st.audit) - 1; i >= 0 && len(entries) < limit; i-- {
+			e := st.audit[i]
+			if (beforeID == 0 || e.ID < beforeID) && auditMatches(f, e) {
+				entries = append(entries, e)
+			}
+		}
+		return nil
+	})
+	return entries, err
+}
+
+func (r memAuditLog) Count(ctx context.Context, f AuditFilter) (int, error) {
+	n := 0
+	err := r.s.do(func(st *memState) error {
+		for _, e := range st.audit {
+			if auditMatches(f, e) {
+				n++
+			}
+		}
+		return nil
+	})
+	return n, err
+}
+
+func (r memAuditLog) Export(ctx context.Context, f AuditFilter, fn func(AuditEntry) error) error {
+	// Copy the entries so fn does not hold the store's lock while it streams
+	var entries []AuditEntry
+	r.s.do(func(st *memState) error {
+		for _, e := range st.audit {
+			if auditMatches(f, e) {
+				entries = append(entries, e)
+			}
+		}
+		return nil
+	})
+	for _, e := range entries {
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// auditMatches reports whether e passes f
+func auditMatches(f AuditFilter, e AuditEntry) bool {
+	return (f.ActorUserID == nil || e.ActorUserID != nil && *e.ActorUserID == *f.ActorUserID) &&
+		(f.Action == "" || e.Action == f.Action) &&
+		(f.EntityType == "" || e.EntityType == f.EntityType) &&
+		(f.EntityID == "" || e.EntityID == f.EntityID) &&
+		(f.RequestID == "" || e.RequestID == f.RequestID) &&
+		(f.From == nil || !e.OccurredAt.Before(*f.From)) &&
+		(f.To == nil || e.OccurredAt.Before(*f.To))
+}
@@ -0,0 +1,246 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"library-system/pkg/models"
+)
+
+type memBooks struct{ s *MemoryStore }
+
+func (r memBooks) List(ctx context.Context, includeDeleted bool) ([]models.Book, error) {
+	var books []models.Book
+	err := r.s.do(func(st *memState) error {
+		for _, b := range st.books {
+			if includeDeleted || b.DeletedAt == nil {
+				books = append(books, b)
+			}
+		}
+		return nil
+	})
+	sort.Slice(books, func(i, j int) bool { return books[i].ID < books[j].ID })
+	return books, err
+}
+
+func (r memBooks) Get(ctx context.Context, id int) (models.Book, error) {
+	var b models.Book
+	err := r.s.do(func(st *memState) error {
+		var ok bool
+		if b, ok = st.books[id]; !ok || b.DeletedAt != nil {
+			return ErrNotFound
+		}
+		return nil
+	})
+	return b, err
+}
+
+func (r memBooks) GetForUpdate(ctx context.Context, id int) (models.Book, error) {
+	return r.modify(id, func(b *models.Book) error { return nil })
+}
+
+func (r memBooks) Create(ctx context.Context, b models.Book) (models.Book, error) {
+	err := r.s.do(func(st *memState) error {
+		b.ID = st.nextID("books")
+		b.AvailableCopies = b.TotalCopies
+		b.Version = 1
+		b.DeletedAt, b.DeletedBy = nil, nil
+		st.books[b.ID] = b
+		return nil
+	})
+	return b, err
+}
+
+func (r memBooks) Update(ctx context.Context, b models.Book) (models.Book, error) {
+	return r.modify(b.ID, func(stored *models.Book) error {
+		stored.Title, stored.Author, stored.PublishedYear = b.Title, b.Author, b.PublishedYear
+		stored.TotalCopies, stored.AvailableCopies = b.TotalCopies, b.AvailableCopies
+		stored.Version++
+		return nil
+	})
+}
+
+func (r memBooks) AdjustAvailable(ctx context.Context, id, delta int) error {
+	_, err := r.modify(id, func(b *models.Book) error {
+		b.AvailableCopies += delta
+		return nil
+	})
+	return err
+}
+
+func (r memBooks) SoftDelete(ctx context.Context, id int, deletedBy *int) (models.Book, error) {
+	now := r.s.now()
+	return r.modify(id, func(b *models.Book) error {
+		b.DeletedAt, b.DeletedBy = &now, deletedBy
+		b.Version++
+		return nil
+	})
+}
+
+func (r memBooks) Restore(ctx context.Context, id int) (models.Book, error) {
+	return r.modify(id, func(b *models.Book) error {
+		b.DeletedAt, b.DeletedBy = nil, nil
+		b.Version++
+		return nil
+	})
+}
+
+func (r memBooks) PurgeDeleted(ctx context.Context, cutoff time.Time) ([]models.Book, error) {
+	var purged []models.Book
+	err := r.s.do(func(st *memState) error {
+		for id, b := range st.books {
+			if b.DeletedAt != nil && b.DeletedAt.Before(cutoff) && !st.borrowed(func(l models.Borrow) bool { return l.BookID == id }) {
+				purged = append(purged, b)
+				delete(st.books, id)
+			}
+		}
+		return nil
+	})
+	sort.Slice(purged, func(i, j int) bool { return purged[i].ID < purged[j].ID })
+	return purged, err
+}
+
+// modify applies fn to a copy of the stored book and saves it unless fn fails
+func (r memBooks) modify(id int, fn func(b *models.Book) error) (models.Book, error) {
+	var b models.Book
+	err := r.s.do(func(st *memState) error {
+		var ok bool
+		if b, ok = st.books[id]; !ok {
+			return ErrNotFound
+		}
+		if err := fn(&b); err != nil {
+			return err
+		}
+		st.books[id] = b
+		return nil
+	})
+	return b, err
+}
+
+type memMembers struct{ s *MemoryStore }
+
+func (r memMembers) List(ctx context.Context, includeDeleted bool) ([]models.Member, error) {
+	var members []models.Member
+	err := r.s.do(func(st *memState) error {
+		for _, m := range st.members {
+			if includeDeleted || m.DeletedAt == nil {
+				members = append(members, m)
+			}
+		}
+		return nil
+	})
+	sort.Slice(members, func(i, j int) bool { return members[i].ID < members[j].ID })
+	return members, err
+}
+
+func (r memMembers) Get(ctx context.Context, id int) (models.Member, error) {
+	var m models.Member
+	err := r.s.do(func(st *memState) error {
+		var ok bool
+		if m, ok = st.members[id]; !ok || m.DeletedAt != nil {
+			return ErrNotFound
+		}
+		return nil
+	})
+	return m, err
+}
+
+func (r memMembers) GetForUpdate(ctx context.Context, id int) (models.Member, error) {
+	return r.modify(id, func(m *models.Member) error { return nil })
+}
+
+func (r memMembers) Create(ctx context.Context, m models.Member) (models.Member, error) {
+	err := r.s.do(func(st *memState) error {
+		if st.memberEmailTaken(m.Email, 0) {
+			return ErrDuplicateEmail
+		}
+		m.ID = st.nextID("members")
+		m.JoinedAt = r.s.now()
+		m.Version = 1
+		m.DeletedAt, m.DeletedBy = nil, nil
+		st.members[m.ID] = m
+		return nil
+	})
+	return m, err
+}
+
+func (r memMembers) Update(ctx context.Context, m models.Member) (models.Member, error) {
+	return r.modify(m.ID, func(stored *models.Member) error {
+		if r.s.state.memberEmailTaken(m.Email, m.ID) {
+			return ErrDuplicateEmail
+		}
+		stored.Name, stored.Email = m.Name, m.Email
+		stored.Version++
+		return nil
+	})
+}
+
+func (r memMembers) SoftDelete(ctx context.Context, id int, deletedBy *int) (models.Member, error) {
+	now := r.s.now()
+	return r.modify(id, func(m *models.Member) error {
+		m.DeletedAt, m.DeletedBy = &now, deletedBy
+		m.Version++
+		return nil
+	})
+}
+
+func (r memMembers) Restore(ctx context.Context, id int) (models.Member, error) {
+	return r.modify(id, func(m *models.Member) error {
+		m.DeletedAt, m.DeletedBy = nil, nil
+		m.Version++
+		return nil
+	})
+}
+
+func (r memMembers) PurgeDeleted(ctx context.Context, cutoff time.Time) ([]models.Member, error) {
+	var purged []models.Member
+	err := r.s.do(func(st *memState) error {
+		for id, m := range st.members {
+			if m.DeletedAt != nil && m.DeletedAt.Before(cutoff) && !st.borrowed(func(l models.Borrow) bool { return l.MemberID == id }) {
+				purged = append(purged, m)
+				delete(st.members, id)
+			}
+		}
+		return nil
+	})
+	sort.Slice(purged, func(i, j int) bool { return purged[i].ID < purged[j].ID })
+	return purged, err
+}
+
+// modify applies fn to a copy of the stored member and saves it unless fn fails
+func (r memMembers) modify(id int, fn func(m *models.Member) error) (models.Member, error) {
+	var m models.Member
+	err := r.s.do(func(st *memState) error {
+		var ok bool
+		if m, ok = st.members[id]; !ok {
+			return ErrNotFound
+		}
+		if err := fn(&m); err != nil {
+			return err
+		}
+		st.members[id] = m
+		return nil
+	})
+	return m, err
+}
+
+// memberEmailTaken mirrors the UNIQUE constraint on members.email, which also covers deleted members
+func (st *memState) memberEmailTaken(email string, exceptID int) bool {
+	for id, m := range st.members {
+		if id != exceptID && m.Email == email {
+			return true
+		}
+	}
+	return false
+}
+
+// borrowed reports whether any borrow record matches, mirroring the borrow foreign keys
+func (st *memState) borrowed(match func(models.Borrow) bool) bool {
+	for _, l := range st.borrows {
+		if match(l) {
+			return true
+		}
+	}
+	return false
+}
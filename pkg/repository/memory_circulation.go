@@ -0,0 +1,114 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"library-system/pkg/models"
+)
+
+type memBorrows struct{ s *MemoryStore }
+
+func (r memBorrows) List(ctx context.Context) ([]models.Borrow, error) {
+	var borrows []models.Borrow
+	err := r.s.do(func(st *memState) error {
+		for _, b := range st.borrows {
+			borrows = append(borrows, b)
+		}
+		return nil
+	})
+	sort.Slice(borrows, func(i, j int) bool { return borrows[i].ID < borrows[j].ID })
+	return borrows, err
+}
+
+func (r memBorrows) GetForUpdate(ctx context.Context, id int) (models.Borrow, error) {
+	var b models.Borrow
+	err := r.s.do(func(st *memState) error {
+		var ok bool
+		if b, ok = st.borrows[id]; !ok {
+			return ErrNotFound
+		}
+		return nil
+	})
+	return b, err
+}
+
+func (r memBorrows) Create(ctx context.Context, memberID, bookID int, dueDate time.Time) (models.Borrow, error) {
+	var b models.Borrow
+	err := r.s.do(func(st *memState) error {
+		// Mirror the foreign keys on borrow
+		if _, ok := st.members[memberID]; !ok {
+			return ErrNotFound
+		}
+		if _, ok := st.books[bookID]; !ok {
+			return ErrNotFound
+		}
+		b = models.Borrow{
+			ID:         st.nextID("borrow"),
+			MemberID:   memberID,
+			BookID:     bookID,
+			BorrowDate: r.s.now(),
+			DueDate:    dueDate,
+			Status:     "borrowed",
+		}
+		st.borrows[b.ID] = b
+		return nil
+	})
+	return b, err
+}
+
+func (r memBorrows) MarkReturned(ctx context.Context, id int) (models.Borrow, error) {
+	var b models.Borrow
+	err := r.s.do(func(st *memState) error {
+		var ok bool
+		if b, ok = st.borrows[id]; !ok {
+			return ErrNotFound
+		}
+		now := r.s.now()
+		b.Status, b.ReturnDate = "returned", &now
+		st.borrows[id] = b
+		return nil
+	})
+	return b, err
+}
+
+func (r memBorrows) Renew(ctx context.Context, id int, dueDate time.Time) (models.Borrow, error) {
+	var b models.Borrow
+	err := r.s.do(func(st *memState) error {
+		var ok bool
+		if b, ok = st.borrows[id]; !ok {
+			return ErrNotFound
+		}
+		b.DueDate = dueDate
+		b.Renewals++
+		st.borrows[id] = b
+		return nil
+	})
+	return b, err
+}
+
+func (r memBorrows) CountActiveByMember(ctx context.Context, memberID int) (int, error) {
+	return r.countActive(func(b models.Borrow) bool { return b.MemberID == memberID })
+}
+
+func (r memBorrows) CountActiveByBook(ctx context.Context, bookID int) (int, error) {
+	return r.countActive(func(b models.Borrow) bool { return b.BookID == bookID })
+}
+
+func (r memBorrows) CountOverdue(ctx context.Context, asOf time.Time) (int, error) {
+	return r.countActive(func(b models.Borrow) bool { return b.DueDate.Before(asOf) })
+}
+
+func (r memBorrows) countActive(match func(models.Borrow) bool) (int, error) {
+	n := 0
+	err := r.s.do(func(st *memState) error {
+		for _, b := range st.borrows {
+			if b.Status == "borrowed" && match(b) {
+				n++
+			}
+		}
+		return nil
+	})
+	return n, err
+}
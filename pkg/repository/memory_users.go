@@ -0,0 +1,198 @@
+package repository
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"library-system/pkg/models"
+)
+
+type memUsers struct{ s *MemoryStore }
+
+func (r memUsers) Get(ctx context.Context, id int) (models.User, error) {
+	var u models.User
+	err := r.s.do(func(st *memState) error {
+		stored, ok := st.users[id]
+		if !ok {
+			return ErrNotFound
+		}
+		u = st.withMember(stored.User)
+		return nil
+	})
+	return u, err
+}
+
+func (r memUsers) UpsertIdentity(ctx context.Context, u models.User) (models.User, error) {
+	err := r.s.do(func(st *memState) error {
+		stored, ok := st.userByIdentity(u.Provider, u.Subject)
+		if !ok {
+			if _, taken := st.userByEmail(u.Email); taken {
+				return ErrIdentityConflict
+			}
+			stored = memUser{User: models.User{ID: st.nextID("users"), Provider: u.Provider, Subject: u.Subject, Email: u.Email, Role: "MEMBER", CreatedAt: r.s.now()}}
+		}
+		// Empty profile fields never overwrite values set by another provider
+		if u.Name != "" {
+			stored.Name = u.Name
+		}
+		if u.AvatarURL != "" {
+			stored.AvatarURL = u.AvatarURL
+		}
+		if u.GoogleID != "" {
+			stored.GoogleID = u.GoogleID
+		}
+		st.users[stored.ID] = stored
+		u = st.withMember(stored.User)
+		return nil
+	})
+	return u, err
+}
+
+func (r memUsers) Credentials(ctx context.Context, email string) (Credentials, error) {
+	var c Credentials
+	err := r.s.do(func(st *memState) error {
+		stored, ok := st.userByEmail(email)
+		if !ok || stored.Provider != "local" {
+			return ErrNotFound
+		}
+		c = Credentials{UserID: stored.ID, Name: stored.Name, PasswordHash: stored.passwordHash}
+		return nil
+	})
+	return c, err
+}
+
+func (r memUsers) CreateLocal(ctx context.Context, email, name, passwordHash string) (int, error) {
+	var id int
+	err := r.s.do(func(st *memState) error {
+		if _, taken := st.userByEmail(email); taken {
+			return ErrDuplicateEmail
+		}
+		stored := memUser{User: models.User{ID: st.nextID("users"), Provider: "local", Subject: email, Email: email, Name: name, Role: "MEMBER", CreatedAt: r.s.now()}}
+		stored.passwordHash = passwordHash
+		st.users[stored.ID] = stored
+		id = stored.ID
+		return nil
+	})
+	return id, err
+}
+
+type memAPIKeys struct{ s *MemoryStore }
+
+func (r memAPIKeys) Create(ctx context.Context, k NewAPIKey) (models.APIKey, error) {
+	var key models.APIKey
+	err := r.s.do(func(st *memState) error {
+		key = models.APIKey{
+			ID:          st.nextID("api_keys"),
+			Name:        k.Name,
+			Prefix:      k.Prefix,
+			Permissions: slices.Clone(k.Permissions),
+			CreatedBy:   k.CreatedBy,
+			CreatedAt:   r.s.now(),
+			ExpiresAt:   k.ExpiresAt,
+		}
+		st.apiKeys[key.ID] = memAPIKey{APIKey: key, keyHash: k.KeyHash}
+		return nil
+	})
+	return key, err
+}
+
+func (r memAPIKeys) GetForUpdate(ctx context.Context, id int) (models.APIKey, error) {
+	var key models.APIKey
+	err := r.s.do(func(st *memState) error {
+		stored, ok := st.apiKeys[id]
+		if !ok {
+			return ErrNotFound
+		}
+		key = stored.APIKey
+		return nil
+	})
+	return key, err
+}
+
+func (r memAPIKeys) Revoke(ctx context.Context, id int) (models.APIKey, error) {
+	var key models.APIKey
+	err := r.s.do(func(st *memState) error {
+		stored, ok := st.apiKeys[id]
+		if !ok {
+			return ErrNotFound
+		}
+		if stored.RevokedAt == nil {
+			now := r.s.now()
+			stored.RevokedAt = &now
+			st.apiKeys[id] = stored
+		}
+		key = stored.APIKey
+		return nil
+	})
+	return key, err
+}
+
+func (r memAPIKeys) List(ctx context.Context) ([]models.APIKey, error) {
+	var keys []models.APIKey
+	err := r.s.do(func(st *memState) error {
+		for _, k := range st.apiKeys {
+			keys = append(keys, k.APIKey)
+		}
+		return nil
+	})
+	slices.SortFunc(keys, func(a, b models.APIKey) int { return b.ID - a.ID })
+	return keys, err
+}
+
+func (r memAPIKeys) Active(ctx context.Context, keyHash string) (models.APIKey, error) {
+	var key models.APIKey
+	err := r.s.do(func(st *memState) error {
+		now := r.s.now()
+		for _, k := range st.apiKeys {
+			if k.keyHash == keyHash && k.RevokedAt == nil && (k.ExpiresAt == nil || k.ExpiresAt.After(now)) {
+				key = k.APIKey
+				return nil
+			}
+		}
+		return ErrNotFound
+	})
+	return key, err
+}
+
+func (r memAPIKeys) Touch(ctx context.Context, id int, t time.Time) error {
+	return r.s.do(func(st *memState) error {
+		stored, ok := st.apiKeys[id]
+		if !ok {
+			return ErrNotFound
+		}
+		stored.LastUsedAt = &t
+		st.apiKeys[id] = stored
+		return nil
+	})
+}
+
+func (st *memState) userByIdentity(provider, subject string) (memUser, bool) {
+	for _, u := range st.users {
+		if u.Provider == provider && u.Subject == subject {
+			return u, true
+		}
+	}
+	return memUser{}, false
+}
+
+func (st *memState) userByEmail(email string) (memUser, bool) {
+	for _, u := range st.users {
+		if u.Email == email {
+			return u, true
+		}
+	}
+	return memUser{}, false
+}
+
+// withMember fills in the live member sharing the user's email
+func (st *memState) withMember(u models.User) models.User {
+	u.MemberID = nil
+	for _, m := range st.members {
+		if m.Email == u.Email && m.DeletedAt == nil {
+			id := m.ID
+			u.MemberID = &id
+		}
+	}
+	return u
+}
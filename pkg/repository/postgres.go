@@ -0,0 +1,229 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"math/rand/v2"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// querier is satisfied by *sql.DB and *sql.Tx
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// rowScanner is satisfied by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// PostgresStore implements Store on the schema in migrations/
+type PostgresStore struct {
+	db      *sql.DB
+	replica *sql.DB // Serves reads outside transactions; nil sends them to db
+	opts    TxOptions
+	q       querier
+	tx      *pgTx // nil outside a transaction
+}
+
+// pgTx is the state shared by the Stores bound to one transaction
+type pgTx struct {
+	onCommit []func()
+}
+
+// TxOptions configures the transactions InTx starts
+type TxOptions struct {
+	Isolation   sql.IsolationLevel // sql.LevelDefault uses the database default, READ COMMITTED
+	MaxAttempts int                // Runs of fn before a serialization failure or deadlock is returned
+	RetryDelay  time.Duration      // Upper bound of the random delay before the first retry; doubles per retry
+}
+
+// DefaultTxOptions retry a transaction twice at the database's default isolation level
+var DefaultTxOptions = TxOptions{MaxAttempts: 3, RetryDelay: 20 * time.Millisecond}
+
+// Postgres error codes after which a transaction can succeed when run again
+const (
+	pqSerializationFailure = "40001"
+	pqDeadlockDetected     = "40P01"
+)
+
+// NewPostgresStore creates a store backed by db
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{db: db, q: db, opts: DefaultTxOptions}
+}
+
+// WithReplica returns a copy of s that sends List, Get and Count calls made
+// outside a transaction to replica. Those reads may lag behind recent writes.
+func (s *PostgresStore) WithReplica(replica *sql.DB) *PostgresStore {
+	c := *s
+	c.replica = replica
+	return &c
+}
+
+// WithTxOptions returns a copy of s whose transactions use opts
+func (s *PostgresStore) WithTxOptions(opts TxOptions) *PostgresStore {
+	c := *s
+	c.opts = opts
+	return &c
+}
+
+func (s *PostgresStore) Books() BookRepository            { return pgBooks{s.q, s.reader()} }
+func (s *PostgresStore) Members() MemberRepository        { return pgMembers{s.q, s.reader()} }
+func (s *PostgresStore) Borrows() BorrowRepository        { return pgBorrows{s.q, s.reader()} }
+func (s *PostgresStore) Users() UserRepository            { return pgUsers{s.q} }
+func (s *PostgresStore) APIKeys() APIKeyRepository        { return pgAPIKeys{s.q} }
+func (s *PostgresStore) AuditLog() AuditLog               { return pgAuditLog{s.q, s.exportDB()} }
+func (s *PostgresStore) IdempotencyKeys() IdempotencyKeys { return pgIdempotencyKeys{s.q} }
+
+// reader is where read-only queries go: the replica, unless a transaction
+// has to see its own writes
+func (s *PostgresStore) reader() querier {
+	if s.replica != nil && s.tx == nil {
+		return s.replica
+	}
+	return s.q
+}
+
+// exportDB is where long reads start their own transaction; nil inside a
+// transaction, whose statement timeout they keep
+func (s *PostgresStore) exportDB() *sql.DB {
+	if s.tx != nil {
+		return nil
+	}
+	return s.db
+}
+
+// InTx retries fn in a new transaction after serialization failures and
+// deadlocks, waiting a random delay so colliding transactions spread out.
+// fn must not have effects outside the transaction; use OnCommit for those.
+func (s *PostgresStore) InTx(ctx context.Context, fn func(tx Store) error) error {
+	if s.tx != nil {
+		return fn(s)
+	}
+	delay := s.opts.RetryDelay
+	for attempt := 1; ; attempt++ {
+		err := s.runTx(ctx, fn)
+		if err == nil || attempt >= s.opts.MaxAttempts || !retryable(err) {
+			return err
+		}
+		slog.DebugContext(ctx, "retrying transaction", "attempt", attempt, "error", err)
+		if delay > 0 {
+			select {
+			case <-time.After(rand.N(delay)):
+			case <-ctx.Done():
+				return err
+			}
+			delay *= 2
+		}
+	}
+}
+
+func (s *PostgresStore) runTx(ctx context.Context, fn func(tx Store) error) error {
+	sqlTx, err := s.db.BeginTx(ctx, &sql.TxOptions{Isolation: s.opts.Isolation})
+	if err != nil {
+		return err
+	}
+	defer sqlTx.Rollback()
+
+	tx := &pgTx{}
+	if err := fn(&PostgresStore{db: s.db, opts: s.opts, q: sqlTx, tx: tx}); err != nil {
+		return err
+	}
+	if err := sqlTx.Commit(); err != nil {
+		return err
+	}
+	for _, f := range tx.onCommit {
+		f()
+	}
+	return nil
+}
+
+func (s *PostgresStore) OnCommit(fn func()) {
+	if s.tx == nil {
+		fn()
+		return
+	}
+	s.tx.onCommit = append(s.tx.onCommit, fn)
+}
+
+// retryable reports whether err aborted a transaction that may succeed when run again
+func retryable(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && (pqErr.Code == pqSerializationFailure || pqErr.Code == pqDeadlockDetected)
+}
+
+// notFound maps sql.ErrNoRows to ErrNotFound
+func notFound(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// uniqueViolation reports whether err is a unique constraint violation
+func uniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+func nullableTime(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+func nullableInt(i sql.NullInt64) *int {
+	if !i.Valid {
+		return nil
+	}
+	v := int(i.Int64)
+	return &v
+}
+
+type pgIdempotencyKeys struct{ q querier }
+
+func (r pgIdempotencyKeys) Claim(ctx context.Context, rec IdempotencyRecord, ttl time.Duration) (bool, error) {
+	// A conflicting insert blocks until a concurrent transaction holding the
+	// same key commits or rolls back
+	var claimed bool
+	err := r.q.QueryRowContext(ctx, `
+		INSERT INTO idempotency_keys (principal, key, operation, request_hash, expires_at)
+		VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP + make_interval(secs => $5))
+		ON CONFLICT (principal, key) DO UPDATE
+			SET operation = EXCLUDED.operation, request_hash = EXCLUDED.request_hash, response = NULL,
+			    created_at = CURRENT_TIMESTAMP, expires_at = EXCLUDED.expires_at
+			WHERE idempotency_keys.expires_at <= CURRENT_TIMESTAMP
+		RETURNING true`,
+		rec.Principal, rec.Key, rec.Operation, rec.RequestHash, ttl.Seconds()).Scan(&claimed)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return claimed, err
+}
+
+func (r pgIdempotencyKeys) Get(ctx context.Context, principal, key string) (IdempotencyRecord, error) {
+	rec := IdempotencyRecord{Principal: principal, Key: key}
+	err := r.q.QueryRowContext(ctx, "SELECT operation, request_hash, response FROM idempotency_keys WHERE principal = $1 AND key = $2", principal, key).
+		Scan(&rec.Operation, &rec.RequestHash, &rec.Response)
+	return rec, notFound(err)
+}
+
+func (r pgIdempotencyKeys) SaveResponse(ctx context.Context, principal, key string, response []byte) error {
+	_, err := r.q.ExecContext(ctx, "UPDATE idempotency_keys SET response = $1 WHERE principal = $2 AND key = $3", string(response), principal, key)
+	return err
+}
+
+func (r pgIdempotencyKeys) DeleteExpired(ctx context.Context) (int64, error) {
+	res, err := r.q.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE expires_at <= CURRENT_TIMESTAMP")
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
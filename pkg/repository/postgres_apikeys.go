@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"library-system/pkg/models"
+
+	"github.com/lib/pq"
+)
+
+const apiKeyColumns = "id, name, prefix, permissions, created_by, created_at, expires_at, revoked_at, last_used_at"
+
+type pgAPIKeys struct{ q querier }
+
+func (r pgAPIKeys) Create(ctx context.Context, k NewAPIKey) (models.APIKey, error) {
+	row := r.q.QueryRowContext(ctx,
+		"INSERT INTO api_keys (name, prefix, key_hash, permissions, created_by, expires_at) VALUES ($1, $2, $3, $4, $5, $6) RETURNING "+apiKeyColumns,
+		k.Name, k.Prefix, k.KeyHash, pq.Array(k.Permissions), k.CreatedBy, k.ExpiresAt)
+	return scanAPIKey(row)
+}
+
+func (r pgAPIKeys) GetForUpdate(ctx context.Context, id int) (models.APIKey, error) {
+	k, err := scanAPIKey(r.q.QueryRowContext(ctx, "SELECT "+apiKeyColumns+" FROM api_keys WHERE id = $1 FOR UPDATE", id))
+	return k, notFound(err)
+}
+
+func (r pgAPIKeys) Revoke(ctx context.Context, id int) (models.APIKey, error) {
+	row := r.q.QueryRowContext(ctx,
+		"UPDATE api_keys SET revoked_at = COALESCE(revoked_at, CURRENT_TIMESTAMP) WHERE id = $1 RETURNING "+apiKeyColumns, id)
+	k, err := scanAPIKey(row)
+	return k, notFound(err)
+}
+
+func (r pgAPIKeys) List(ctx context.Context) ([]models.APIKey, error) {
+	rows, err := r.q.QueryContext(ctx, "SELECT "+apiKeyColumns+" FROM api_keys ORDER BY id DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []models.APIKey
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+func (r pgAPIKeys) Active(ctx context.Context, keyHash string) (models.APIKey, error) {
+	row := r.q.QueryRowContext(ctx,
+		"SELECT "+apiKeyColumns+" FROM api_keys WHERE key_hash = $1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP)",
+		keyHash)
+	k, err := scanAPIKey(row)
+	return k, notFound(err)
+}
+
+func (r pgAPIKeys) Touch(ctx context.Context, id int, t time.Time) error {
+	_, err := r.q.ExecContext(ctx, "UPDATE api_keys SET last_used_at = $1 WHERE id = $2", t, id)
+	return err
+}
+
+func scanAPIKey(row rowScanner) (models.APIKey, error) {
+	var k models.APIKey
+	var createdBy sql.NullInt64
+	var expiresAt, revokedAt, lastUsedAt sql.NullTime
+	err := row.Scan(&k.ID, &k.Name, &k.Prefix, pq.Array(&k.Permissions), &createdBy, &k.CreatedAt, &expiresAt, &revokedAt, &lastUsedAt)
+	if err != nil {
+		return k, err
+	}
+	k.CreatedBy = nullableInt(createdBy)
+	k.ExpiresAt = nullableTime(expiresAt)
+	k.RevokedAt = nullableTime(revokedAt)
+	k.LastUsedAt = nullableTime(lastUsedAt)
+	return k, nil
+}
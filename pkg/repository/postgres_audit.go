@@ -0,0 +1,136 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+const auditColumns = "id, occurred_at, actor, actor_user_id, actor_api_key_id, action, entity_type, COALESCE(entity_id, ''), before::text, after::text, COALESCE(request_id, ''), COALESCE(ip, '')"
+
+type pgAuditLog struct {
+	q  querier
+	db *sql.DB // Starts the transactions of Export; nil inside a transaction
+}
+
+func (r pgAuditLog) Append(ctx context.Context, rec AuditRecord) error {
+	_, err := r.q.ExecContext(ctx, `
+		INSERT INTO audit_log (actor, actor_user_id, actor_api_key_id, action, entity_type, entity_id, before, after, request_id, ip)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, ''), NULLIF($10, ''))`,
+		rec.Actor, rec.ActorUserID, rec.ActorAPIKeyID, rec.Action, rec.EntityType, rec.EntityID, rec.Before, rec.After,
+		rec.RequestID, rec.IP)
+	return err
+}
+
+func (r pgAuditLog) List(ctx context.Context, f AuditFilter, beforeID int64, limit int) ([]AuditEntry, error) {
+	cond, args := auditWhere(f)
+	if beforeID > 0 {
+		args = append(args, beforeID)
+		cond += fmt.Sprintf(" AND id < $%d", len(args))
+	}
+	args = append(args, limit)
+	query := fmt.Sprintf("SELECT %s FROM audit_log WHERE %s ORDER BY id DESC LIMIT $%d", auditColumns, cond, len(args))
+
+	var entries []AuditEntry
+	err := scanAuditEntries(ctx, r.q, query, args, func(e AuditEntry) error {
+		entries = append(entries, e)
+		return nil
+	})
+	return entries, err
+}
+
+func (r pgAuditLog) Count(ctx context.Context, f AuditFilter) (int, error) {
+	cond, args := auditWhere(f)
+	var n int
+	err := r.q.QueryRowContext(ctx, "SELECT COUNT(*) FROM audit_log WHERE "+cond, args...).Scan(&n)
+	return n, err
+}
+
+func (r pgAuditLog) Export(ctx context.Context, f AuditFilter, fn func(AuditEntry) error) error {
+	cond, args := auditWhere(f)
+	query := fmt.Sprintf("SELECT %s FROM audit_log WHERE %s ORDER BY id", auditColumns, cond)
+	if r.db == nil {
+		return scanAuditEntries(ctx, r.q, query, args, fn)
+	}
+
+	// Streaming to a slow client can outlast database.statement_timeout; the
+	// request context still bounds the export
+	tx, err := r.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, "SET LOCAL statement_timeout = 0"); err != nil {
+		return err
+	}
+	if err := scanAuditEntries(ctx, tx, query, args, fn); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// auditWhere builds the SQL condition for f, numbering parameters from 1
+func auditWhere(f AuditFilter) (string, []interface{}) {
+	var conds []string
+	var args []interface{}
+	add := func(cond string, arg interface{}) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+	if f.ActorUserID != nil {
+		add("actor_user_id = $%d", *f.ActorUserID)
+	}
+	if f.Action != "" {
+		add("action = $%d", f.Action)
+	}
+	if f.EntityType != "" {
+		add("entity_type = $%d", f.EntityType)
+	}
+	if f.EntityID != "" {
+		add("entity_id = $%d", f.EntityID)
+	}
+	if f.RequestID != "" {
+		add("request_id = $%d", f.RequestID)
+	}
+	if f.From != nil {
+		add("occurred_at >= $%d", *f.From)
+	}
+	if f.To != nil {
+		add("occurred_at < $%d", *f.To)
+	}
+	if len(conds) == 0 {
+		return "TRUE", nil
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+// scanAuditEntries runs query on q and passes each scanned entry to fn
+func scanAuditEntries(ctx context.Context, q querier, query string, args []interface{}, fn func(AuditEntry) error) error {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e AuditEntry
+		var actorUserID, actorAPIKeyID sql.NullInt64
+		var before, after sql.NullString
+		if err := rows.Scan(&e.ID, &e.OccurredAt, &e.Actor, &actorUserID, &actorAPIKeyID, &e.Action, &e.EntityType, &e.EntityID, &before, &after, &e.RequestID, &e.IP); err != nil {
+			return err
+		}
+		e.ActorUserID = nullableInt(actorUserID)
+		e.ActorAPIKeyID = nullableInt(actorAPIKeyID)
+		if before.Valid {
+			e.Before = &before.String
+		}
+		if after.Valid {
+			e.After = &after.String
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"library-system/pkg/models"
+)
+
+const bookColumns = "id, title, author, published_year, total_copies, available_copies, version, deleted_at, deleted_by"
+
+func scanBook(row rowScanner) (models.Book, error) {
+	var b models.Book
+	var deletedAt sql.NullTime
+	var deletedBy sql.NullInt64
+	if err := row.Scan(&b.ID, &b.Title, &b.Author, &b.PublishedYear, &b.TotalCopies, &b.AvailableCopies, &b.Version, &deletedAt, &deletedBy); err != nil {
+		return b, notFound(err)
+	}
+	b.DeletedAt, b.DeletedBy = nullableTime(deletedAt), nullableInt(deletedBy)
+	return b, nil
+}
+
+func scanBooks(rows *sql.Rows, err error) ([]models.Book, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var books []models.Book
+	for rows.Next() {
+		b, err := scanBook(rows)
+		if err != nil {
+			return nil, err
+		}
+		books = append(books, b)
+	}
+	return books, rows.Err()
+}
+
+// pgBooks reads through read, which is a replica outside transactions when one is configured
+type pgBooks struct{ q, read querier }
+
+func (r pgBooks) List(ctx context.Context, includeDeleted bool) ([]models.Book, error) {
+	query := "SELECT " + bookColumns + " FROM books WHERE deleted_at IS NULL ORDER BY id"
+	if includeDeleted {
+		query = "SELECT " + bookColumns + " FROM books ORDER BY id"
+	}
+	return scanBooks(r.read.QueryContext(ctx, query))
+}
+
+func (r pgBooks) Get(ctx context.Context, id int) (models.Book, error) {
+	return scanBook(r.read.QueryRowContext(ctx, "SELECT "+bookColumns+" FROM books WHERE id = $1 AND deleted_at IS NULL", id))
+}
+
+func (r pgBooks) GetForUpdate(ctx context.Context, id int) (models.Book, error) {
+	return scanBook(r.q.QueryRowContext(ctx, "SELECT "+bookColumns+" FROM books WHERE id = $1 FOR UPDATE", id))
+}
+
+func (r pgBooks) Create(ctx context.Context, b models.Book) (models.Book, error) {
+	return scanBook(r.q.QueryRowContext(ctx,
+		"INSERT INTO books (title, author, published_year, total_copies, available_copies) VALUES ($1, $2, $3, $4, $4) RETURNING "+bookColumns,
+		b.Title, b.Author, b.PublishedYear, b.TotalCopies))
+}
+
+func (r pgBooks) Update(ctx context.Context, b models.Book) (models.Book, error) {
+	return scanBook(r.q.QueryRowContext(ctx,
+		"UPDATE books SET title = $1, author = $2, published_year = $3, total_copies = $4, available_copies = $5, version = version + 1 WHERE id = $6 RETURNING "+bookColumns,
+		b.Title, b.Author, b.PublishedYear, b.TotalCopies, b.AvailableCopies, b.ID))
+}
+
+func (r pgBooks) AdjustAvailable(ctx context.Context, id, delta int) error {
+	res, err := r.q.ExecContext(ctx, "UPDATE books SET available_copies = available_copies + $1 WHERE id = $2", delta, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (r pgBooks) SoftDelete(ctx context.Context, id int, deletedBy *int) (models.Book, error) {
+	return scanBook(r.q.QueryRowContext(ctx,
+		"UPDATE books SET deleted_at = CURRENT_TIMESTAMP, deleted_by = $1, version = version + 1 WHERE id = $2 RETURNING "+bookColumns, deletedBy, id))
+}
+
+func (r pgBooks) Restore(ctx context.Context, id int) (models.Book, error) {
+	return scanBook(r.q.QueryRowContext(ctx,
+		"UPDATE books SET deleted_at = NULL, deleted_by = NULL, version = version + 1 WHERE id = $1 RETURNING "+bookColumns, id))
+}
+
+func (r pgBooks) PurgeDeleted(ctx context.Context, cutoff time.Time) ([]models.Book, error) {
+	return scanBooks(r.q.QueryContext(ctx, `
+		DELETE FROM books
+		WHERE deleted_at < $1
+		  AND NOT EXISTS (SELECT 1 FROM borrow WHERE borrow.book_id = books.id)
+		RETURNING `+bookColumns, cutoff))
+}
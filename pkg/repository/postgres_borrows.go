@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"library-system/pkg/models"
+)
+
+const borrowColumns = "id, member_id, book_id, borrow_date, due_date, return_date, status, renewals"
+
+func scanBorrow(row rowScanner) (models.Borrow, error) {
+	var b models.Borrow
+	var returnDate sql.NullTime
+	if err := row.Scan(&b.ID, &b.MemberID, &b.BookID, &b.BorrowDate, &b.DueDate, &returnDate, &b.Status, &b.Renewals); err != nil {
+		return b, notFound(err)
+	}
+	b.ReturnDate = nullableTime(returnDate)
+	return b, nil
+}
+
+// pgBorrows reads through read, which is a replica outside transactions when one is configured
+type pgBorrows struct{ q, read querier }
+
+func (r pgBorrows) List(ctx context.Context) ([]models.Borrow, error) {
+	rows, err := r.read.QueryContext(ctx, "SELECT "+borrowColumns+" FROM borrow ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var borrows []models.Borrow
+	for rows.Next() {
+		b, err := scanBorrow(rows)
+		if err != nil {
+			return nil, err
+		}
+		borrows = append(borrows, b)
+	}
+	return borrows, rows.Err()
+}
+
+func (r pgBorrows) GetForUpdate(ctx context.Context, id int) (models.Borrow, error) {
+	return scanBorrow(r.q.QueryRowContext(ctx, "SELECT "+borrowColumns+" FROM borrow WHERE id = $1 FOR UPDATE", id))
+}
+
+func (r pgBorrows) Create(ctx context.Context, memberID, bookID int, dueDate time.Time) (models.Borrow, error) {
+	return scanBorrow(r.q.QueryRowContext(ctx,
+		"INSERT INTO borrow (member_id, book_id, due_date, status) VALUES ($1, $2, $3, 'borrowed') RETURNING "+borrowColumns, memberID, bookID, dueDate))
+}
+
+func (r pgBorrows) MarkReturned(ctx context.Context, id int) (models.Borrow, error) {
+	return scanBorrow(r.q.QueryRowContext(ctx,
+		"UPDATE borrow SET status = 'returned', return_date = CURRENT_TIMESTAMP WHERE id = $1 RETURNING "+borrowColumns, id))
+}
+
+func (r pgBorrows) Renew(ctx context.Context, id int, dueDate time.Time) (models.Borrow, error) {
+	return scanBorrow(r.q.QueryRowContext(ctx,
+		"UPDATE borrow SET due_date = $1, renewals = renewals + 1 WHERE id = $2 RETURNING "+borrowColumns, dueDate, id))
+}
+
+func (r pgBorrows) CountActiveByMember(ctx context.Context, memberID int) (int, error) {
+	var n int
+	err := r.read.QueryRowContext(ctx, "SELECT COUNT(*) FROM borrow WHERE member_id = $1 AND status = 'borrowed'", memberID).Scan(&n)
+	return n, err
+}
+
+func (r pgBorrows) CountActiveByBook(ctx context.Context, bookID int) (int, error) {
+	var n int
+	err := r.read.QueryRowContext(ctx, "SELECT COUNT(*) FROM borrow WHERE book_id = $1 AND status = 'borrowed'", bookID).Scan(&n)
+	return n, err
+}
+
+func (r pgBorrows) CountOverdue(ctx context.Context, asOf time.Time) (int, error) {
+	var n int
+	err := r.read.QueryRowContext(ctx, "SELECT COUNT(*) FROM borrow WHERE status = 'borrowed' AND due_date < $1", asOf).Scan(&n)
+	return n, err
+}
@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"library-system/pkg/models"
+)
+
+const memberColumns = "id, name, email, joined_at, version, deleted_at, deleted_by"
+
+func scanMember(row rowScanner) (models.Member, error) {
+	var m models.Member
+	var deletedAt sql.NullTime
+	var deletedBy sql.NullInt64
+	if err := row.Scan(&m.ID, &m.Name, &m.Email, &m.JoinedAt, &m.Version, &deletedAt, &deletedBy); err != nil {
+		if uniqueViolation(err) {
+			return m, ErrDuplicateEmail
+		}
+		return m, notFound(err)
+	}
+	m.DeletedAt, m.DeletedBy = nullableTime(deletedAt), nullableInt(deletedBy)
+	return m, nil
+}
+
+func scanMembers(rows *sql.Rows, err error) ([]models.Member, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var members []models.Member
+	for rows.Next() {
+		m, err := scanMember(rows)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
+
+// pgMembers reads through read, which is a replica outside transactions when one is configured
+type pgMembers struct{ q, read querier }
+
+func (r pgMembers) List(ctx context.Context, includeDeleted bool) ([]models.Member, error) {
+	query := "SELECT " + memberColumns + " FROM members WHERE deleted_at IS NULL ORDER BY id"
+	if includeDeleted {
+		query = "SELECT " + memberColumns + " FROM members ORDER BY id"
+	}
+	return scanMembers(r.read.QueryContext(ctx, query))
+}
+
+func (r pgMembers) Get(ctx context.Context, id int) (models.Member, error) {
+	return scanMember(r.read.QueryRowContext(ctx, "SELECT "+memberColumns+" FROM members WHERE id = $1 AND deleted_at IS NULL", id))
+}
+
+func (r pgMembers) GetForUpdate(ctx context.Context, id int) (models.Member, error) {
+	return scanMember(r.q.QueryRowContext(ctx, "SELECT "+memberColumns+" FROM members WHERE id = $1 FOR UPDATE", id))
+}
+
+func (r pgMembers) Create(ctx context.Context, m models.Member) (models.Member, error) {
+	return scanMember(r.q.QueryRowContext(ctx, "INSERT INTO members (name, email) VALUES ($1, $2) RETURNING "+memberColumns, m.Name, m.Email))
+}
+
+func (r pgMembers) Update(ctx context.Context, m models.Member) (models.Member, error) {
+	return scanMember(r.q.QueryRowContext(ctx,
+		"UPDATE members SET name = $1, email = $2, version = version + 1 WHERE id = $3 RETURNING "+memberColumns, m.Name, m.Email, m.ID))
+}
+
+func (r pgMembers) SoftDelete(ctx context.Context, id int, deletedBy *int) (models.Member, error) {
+	return scanMember(r.q.QueryRowContext(ctx,
+		"UPDATE members SET deleted_at = CURRENT_TIMESTAMP, deleted_by = $1, version = version + 1 WHERE id = $2 RETURNING "+memberColumns, deletedBy, id))
+}
+
+func (r pgMembers) Restore(ctx context.Context, id int) (models.Member, error) {
+	return scanMember(r.q.QueryRowContext(ctx,
+		"UPDATE members SET deleted_at = NULL, deleted_by = NULL, version = version + 1 WHERE id = $1 RETURNING "+memberColumns, id))
+}
+
+func (r pgMembers) PurgeDeleted(ctx context.Context, cutoff time.Time) ([]models.Member, error) {
+	return scanMembers(r.q.QueryContext(ctx, `
+		DELETE FROM members
+		WHERE deleted_at < $1
+		  AND NOT EXISTS (SELECT 1 FROM borrow WHERE borrow.member_id = members.id)
+		RETURNING `+memberColumns, cutoff))
+}
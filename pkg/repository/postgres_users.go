@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"library-system/pkg/models"
+)
+
+// linkedMember selects the live member sharing the user's email
+const linkedMember = "(SELECT m.id FROM members m WHERE m.email = users.email AND m.deleted_at IS NULL)"
+
+type pgUsers struct{ q querier }
+
+func (r pgUsers) Get(ctx context.Context, id int) (models.User, error) {
+	var u models.User
+	var memberID sql.NullInt64
+	err := r.q.QueryRowContext(ctx, "SELECT id, email, COALESCE(name, ''), COALESCE(avatar_url, ''), role, provider, "+linkedMember+" FROM users WHERE id = $1", id).
+		Scan(&u.ID, &u.Email, &u.Name, &u.AvatarURL, &u.Role, &u.Provider, &memberID)
+	if err != nil {
+		return u, notFound(err)
+	}
+	u.MemberID = nullableInt(memberID)
+	return u, nil
+}
+
+func (r pgUsers) UpsertIdentity(ctx context.Context, u models.User) (models.User, error) {
+	// Only the identity that created an account signs in to it: a new
+	// identity claiming a taken email violates the email constraint instead
+	// of being linked. Empty profile fields (e.g. from local logins) never
+	// overwrite stored values.
+	query := `
+		INSERT INTO users (google_id, provider, subject, email, name, avatar_url, role)
+		VALUES (NULLIF($1, ''), $2, $3, $4, $5, $6, 'MEMBER')
+		ON CONFLICT (provider, subject) DO UPDATE
+		SET name = COALESCE(NULLIF(EXCLUDED.name, ''), users.name),
+			avatar_url = COALESCE(NULLIF(EXCLUDED.avatar_url, ''), users.avatar_url)
+		RETURNING id, email, role, ` + linkedMember
+
+	var memberID sql.NullInt64
+	err := r.q.QueryRowContext(ctx, query, u.GoogleID, u.Provider, u.Subject, u.Email, u.Name, u.AvatarURL).Scan(&u.ID, &u.Email, &u.Role, &memberID)
+	if uniqueViolation(err) {
+		return u, ErrIdentityConflict
+	}
+	u.MemberID = nullableInt(memberID)
+	return u, err
+}
+
+func (r pgUsers) Credentials(ctx context.Context, email string) (Credentials, error) {
+	var c Credentials
+	var name, hash sql.NullString
+	err := r.q.QueryRowContext(ctx, "SELECT id, name, password_hash FROM users WHERE provider = 'local' AND email = $1", email).Scan(&c.UserID, &name, &hash)
+	c.Name, c.PasswordHash = name.String, hash.String
+	return c, notFound(err)
+}
+
+func (r pgUsers) CreateLocal(ctx context.Context, email, name, passwordHash string) (int, error) {
+	query := `
+		INSERT INTO users (provider, subject, email, name, password_hash, role)
+		VALUES ('local', $1, $1, $2, $3, 'MEMBER')
+		RETURNING id`
+
+	var id int
+	err := r.q.QueryRowContext(ctx, query, email, name, passwordHash).Scan(&id)
+	if uniqueViolation(err) {
+		return 0, ErrDuplicateEmail
+	}
+	return id, err
+}
@@ -0,0 +1,215 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"library-system/pkg/models"
+)
+
+var (
+	// ErrNotFound is returned when the requested row does not exist
+	ErrNotFound = errors.New("not found")
+	// ErrDuplicateEmail is returned when a member's email is already taken
+	ErrDuplicateEmail = errors.New("email already in use")
+	// ErrIdentityConflict is returned when an identity's email belongs to an
+	// account created through another identity
+	ErrIdentityConflict = errors.New("email belongs to an account with another sign-in method")
+)
+
+// Store gives access to all repositories. PostgresStore is used in production;
+// MemoryStore keeps everything in process for tests and local experiments.
+type Store interface {
+	Books() BookRepository
+	Members() MemberRepository
+	Borrows() BorrowRepository
+	Users() UserRepository
+	APIKeys() APIKeyRepository
+	AuditLog() AuditLog
+	IdempotencyKeys() IdempotencyKeys
+
+	// InTx runs fn with a Store bound to a single transaction, committing when
+	// fn returns nil and rolling back otherwise. On a Store already bound to a
+	// transaction, fn joins that transaction.
+	InTx(ctx context.Context, fn func(tx Store) error) error
+	// OnCommit runs fn once the transaction the Store is bound to commits, and
+	// never if it rolls back. Outside a transaction fn runs immediately.
+	OnCommit(fn func())
+}
+
+// BookRepository stores the catalog
+type BookRepository interface {
+	// List returns books by id, hiding soft-deleted ones unless includeDeleted
+	List(ctx context.Context, includeDeleted bool) ([]models.Book, error)
+	// Get returns a book that is not soft deleted
+	Get(ctx context.Context, id int) (models.Book, error)
+	// GetForUpdate returns a book, deleted or not, locked until the transaction ends
+	GetForUpdate(ctx context.Context, id int) (models.Book, error)
+	// Create inserts a book with all copies available
+	Create(ctx context.Context, b models.Book) (models.Book, error)
+	// Update saves the editable fields and available copies of b and increments its version
+	Update(ctx context.Context, b models.Book) (models.Book, error)
+	// AdjustAvailable adds delta to the available copies without changing the version
+	AdjustAvailable(ctx context.Context, id, delta int) error
+	SoftDelete(ctx context.Context, id int, deletedBy *int) (models.Book, error)
+	Restore(ctx context.Context, id int) (models.Book, error)
+	// PurgeDeleted permanently removes books soft deleted before cutoff that no borrow record references
+	PurgeDeleted(ctx context.Context, cutoff time.Time) ([]models.Book, error)
+}
+
+// MemberRepository stores library members
+type MemberRepository interface {
+	// List returns members by id, hiding soft-deleted ones unless includeDeleted
+	List(ctx context.Context, includeDeleted bool) ([]models.Member, error)
+	// Get returns a member that is not soft deleted
+	Get(ctx context.Context, id int) (models.Member, error)
+	// GetForUpdate returns a member, deleted or not, locked until the transaction ends
+	GetForUpdate(ctx context.Context, id int) (models.Member, error)
+	Create(ctx context.Context, m models.Member) (models.Member, error)
+	// Update saves the name and email of m and increments its version
+	Update(ctx context.Context, m models.Member) (models.Member, error)
+	SoftDelete(ctx context.Context, id int, deletedBy *int) (models.Member, error)
+	Restore(ctx context.Context, id int) (models.Member, error)
+	// PurgeDeleted permanently removes members soft deleted before cutoff that no borrow record references
+	PurgeDeleted(ctx context.Context, cutoff time.Time) ([]models.Member, error)
+}
+
+// BorrowRepository stores loans
+type BorrowRepository interface {
+	List(ctx context.Context) ([]models.Borrow, error)
+	// GetForUpdate returns a loan locked until the transaction ends
+	GetForUpdate(ctx context.Context, id int) (models.Borrow, error)
+	// Create records a new loan with status "borrowed"
+	Create(ctx context.Context, memberID, bookID int, dueDate time.Time) (models.Borrow, error)
+	// MarkReturned sets the status to "returned" and records the return date
+	MarkReturned(ctx context.Context, id int) (models.Borrow, error)
+	// Renew moves the due date and increments the renewal count
+	Renew(ctx context.Context, id int, dueDate time.Time) (models.Borrow, error)
+	CountActiveByMember(ctx context.Context, memberID int) (int, error)
+	CountActiveByBook(ctx context.Context, bookID int) (int, error)
+	// CountOverdue counts active loans due before asOf
+	CountOverdue(ctx context.Context, asOf time.Time) (int, error)
+}
+
+// Credentials are what a local login is checked against
+type Credentials struct {
+	UserID       int
+	Name         string
+	PasswordHash string // Empty for users without a local password
+}
+
+// UserRepository stores login accounts. Accounts are keyed by the provider
+// and subject that created them, and emails are unique; the linked MemberID
+// is the live member with the same email.
+type UserRepository interface {
+	Get(ctx context.Context, id int) (models.User, error)
+	// UpsertIdentity creates the account for u's provider and subject, or
+	// updates its profile. Empty profile fields never overwrite stored values,
+	// and the stored email is kept. It returns ErrIdentityConflict when
+	// another account has u.Email.
+	UpsertIdentity(ctx context.Context, u models.User) (models.User, error)
+	Credentials(ctx context.Context, email string) (Credentials, error)
+	// CreateLocal creates a local account for email with a password hash. It
+	// returns ErrDuplicateEmail when any account, local or not, has the email.
+	CreateLocal(ctx context.Context, email, name, passwordHash string) (int, error)
+}
+
+// AuditRecord is a new audit log entry; see package audit
+type AuditRecord struct {
+	Actor         string
+	ActorUserID   *int
+	ActorAPIKeyID *int
+	Action        string
+	EntityType    string
+	EntityID      string
+	Before        *string
+	After         *string
+	RequestID     string
+	IP            string
+}
+
+// NewAPIKey is an API key to store. Only the hash of the key is kept.
+type NewAPIKey struct {
+	Name        string
+	Prefix      string
+	KeyHash     string
+	Permissions []string
+	CreatedBy   *int
+	ExpiresAt   *time.Time
+}
+
+// APIKeyRepository stores the API keys of machine clients
+type APIKeyRepository interface {
+	Create(ctx context.Context, k NewAPIKey) (models.APIKey, error)
+	// GetForUpdate returns the key with id, locked until the transaction ends
+	GetForUpdate(ctx context.Context, id int) (models.APIKey, error)
+	// Revoke revokes the key with id; revoking a revoked key keeps its revocation time
+	Revoke(ctx context.Context, id int) (models.APIKey, error)
+	// List returns all keys, newest first
+	List(ctx context.Context) ([]models.APIKey, error)
+	// Active returns the unrevoked, unexpired key with keyHash
+	Active(ctx context.Context, keyHash string) (models.APIKey, error)
+	// Touch records that the key with id was used at t
+	Touch(ctx context.Context, id int, t time.Time) error
+}
+
+// AuditEntry is one immutable audit log record
+type AuditEntry struct {
+	ID            int64     `json:"id"`
+	OccurredAt    time.Time `json:"occurred_at"`
+	Actor         string    `json:"actor"` // "user:<id>", "apikey:<id>" or "system"
+	ActorUserID   *int      `json:"actor_user_id,omitempty"`
+	ActorAPIKeyID *int      `json:"actor_api_key_id,omitempty"`
+	Action        string    `json:"action"`
+	EntityType    string    `json:"entity_type"`
+	EntityID      string    `json:"entity_id"`
+	Before        *string   `json:"before,omitempty"` // JSON snapshot, nil for creations
+	After         *string   `json:"after,omitempty"`  // JSON snapshot, nil for deletions
+	RequestID     string    `json:"request_id"`
+	IP            string    `json:"ip"`
+}
+
+// AuditFilter narrows an audit log query. Zero values match everything.
+type AuditFilter struct {
+	ActorUserID *int
+	Action      string
+	EntityType  string
+	EntityID    string
+	RequestID   string
+	From        *time.Time
+	To          *time.Time
+}
+
+// AuditLog is the append-only audit trail
+type AuditLog interface {
+	Append(ctx context.Context, rec AuditRecord) error
+	// List returns up to limit entries matching f, newest first, with IDs
+	// below beforeID unless it is 0
+	List(ctx context.Context, f AuditFilter, beforeID int64, limit int) ([]AuditEntry, error)
+	Count(ctx context.Context, f AuditFilter) (int, error)
+	// Export passes all entries matching f to fn, oldest first. Outside a
+	// transaction it is not bound by the statement timeout, as fn may stream
+	// to a slow client.
+	Export(ctx context.Context, f AuditFilter, fn func(AuditEntry) error) error
+}
+
+// IdempotencyRecord is the stored outcome of a request made with an idempotency key
+type IdempotencyRecord struct {
+	Principal   string
+	Key         string
+	Operation   string
+	RequestHash string
+	Response    []byte // nil until the first attempt succeeds
+}
+
+// IdempotencyKeys stores idempotency records per principal and key
+type IdempotencyKeys interface {
+	// Claim stores rec for ttl unless a live record exists for its principal and
+	// key, and reports whether it did. Expired records are replaced. A claim
+	// waits while another transaction holds the same key.
+	Claim(ctx context.Context, rec IdempotencyRecord, ttl time.Duration) (bool, error)
+	Get(ctx context.Context, principal, key string) (IdempotencyRecord, error)
+	SaveResponse(ctx context.Context, principal, key string, response []byte) error
+	DeleteExpired(ctx context.Context) (int64, error)
+}
@@ -0,0 +1,116 @@
+package schema
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"library-system/pkg/circulation"
+	"library-system/pkg/idempotency"
+
+	"github.com/lib/pq"
+)
+
+// Error codes reported in the extensions.code field of GraphQL errors
+const (
+	CodeConflict             = "CONFLICT"
+	CodeIdempotencyKeyReused = "IDEMPOTENCY_KEY_REUSED"
+	CodeTimeout              = "TIMEOUT"
+	CodeCancelled            = "CANCELLED"
+)
+
+// Postgres error codes for statements stopped by statement_timeout and lock_timeout
+const (
+	pqQueryCanceled    = "57014"
+	pqLockNotAvailable = "55P03"
+)
+
+// codedError is a resolver error with a machine-readable code, which
+// graphql-go reports through gqlerrors.ExtendedError
+type codedError struct {
+	message    string
+	extensions map[string]interface{}
+}
+
+func (e *codedError) Error() string {
+	return e.message
+}
+
+func (e *codedError) Extensions() map[string]interface{} {
+	return e.extensions
+}
+
+// conflictError reports an expected_version that no longer matches the stored row
+func conflictError(entity string, id, expected, current int) error {
+	return &codedError{
+		message: fmt.Sprintf("conflict: %s %d has been modified (expected version %d, current version %d)", entity, id, expected, current),
+		extensions: map[string]interface{}{
+			"code":            CodeConflict,
+			"current_version": current,
+		},
+	}
+}
+
+// checkVersion enforces the optional expected_version argument against the locked row's version
+func checkVersion(args map[string]interface{}, entity string, id, current int) error {
+	if expected, ok := args["expected_version"].(int); ok && expected != current {
+		return conflictError(entity, id, expected, current)
+	}
+	return nil
+}
+
+// idempotencyError gives a reused idempotency key its error code
+func idempotencyError(err error) error {
+	if errors.Is(err, idempotency.ErrKeyReused) {
+		return &codedError{
+			message:    err.Error(),
+			extensions: map[string]interface{}{"code": CodeIdempotencyKeyReused},
+		}
+	}
+	return err
+}
+
+// circulationError reports a broken circulation rule with its code, falling
+// back to idempotencyError
+func circulationError(err error) error {
+	var rule *circulation.Error
+	if errors.As(err, &rule) {
+		return &codedError{
+			message:    rule.Message,
+			extensions: map[string]interface{}{"code": rule.Code},
+		}
+	}
+	return idempotencyError(err)
+}
+
+// timeoutError reports a resolver cut short by its deadline, the client
+// going away or a database timeout, instead of the driver's message
+func timeoutError(ctx context.Context, err error) error {
+	var pqErr *pq.Error
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return &codedError{
+			message:    "request timed out",
+			extensions: map[string]interface{}{"code": CodeTimeout},
+		}
+	case errors.Is(err, context.Canceled):
+		return &codedError{
+			message:    "request cancelled by the client",
+			extensions: map[string]interface{}{"code": CodeCancelled},
+		}
+	case errors.As(err, &pqErr) && pqErr.Code == pqQueryCanceled:
+		// lib/pq reports its own cancellation of a statement with the same code
+		if ctx.Err() != nil {
+			return timeoutError(ctx, ctx.Err())
+		}
+		return &codedError{
+			message:    "database statement timed out",
+			extensions: map[string]interface{}{"code": CodeTimeout},
+		}
+	case errors.As(err, &pqErr) && pqErr.Code == pqLockNotAvailable:
+		return &codedError{
+			message:    "timed out waiting for a locked record; try again",
+			extensions: map[string]interface{}{"code": CodeTimeout},
+		}
+	}
+	return err
+}
@@ -0,0 +1,26 @@
+package schema
+
+import (
+	"library-system/pkg/idempotency"
+
+	"github.com/graphql-go/graphql"
+)
+
+// idempotencyKey returns the idempotency_key argument, falling back to the Idempotency-Key header
+func idempotencyKey(p graphql.ResolveParams) string {
+	if key, ok := p.Args["idempotency_key"].(string); ok && key != "" {
+		return key
+	}
+	return idempotency.KeyFrom(p.Context)
+}
+
+// idempotentArgs are the arguments compared on a retry: all except the key itself
+func idempotentArgs(args map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(args))
+	for k, v := range args {
+		if k != "idempotency_key" {
+			out[k] = v
+		}
+	}
+	return out
+}
@@ -0,0 +1,64 @@
+package schema
+
+import (
+	"context"
+	"errors"
+	"library-system/pkg/auth"
+	"library-system/pkg/models"
+	"library-system/pkg/repository"
+)
+
+var (
+	errMemberNotFound = errors.New("member not found")
+	errBookNotFound   = errors.New("book not found")
+)
+
+// resolveInTx runs fn in a transaction on store and hands its result to graphql-go
+func resolveInTx[T any](ctx context.Context, store repository.Store, fn func(tx repository.Store) (T, error)) (interface{}, error) {
+	var result T
+	err := store.InTx(ctx, func(tx repository.Store) error {
+		var err error
+		result, err = fn(tx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// lockBook locks a book for update, treating it as missing unless its
+// deleted state matches deleted
+func lockBook(ctx context.Context, tx repository.Store, id int, deleted bool) (models.Book, error) {
+	b, err := tx.Books().GetForUpdate(ctx, id)
+	if errors.Is(err, repository.ErrNotFound) || (err == nil && (b.DeletedAt != nil) != deleted) {
+		if deleted {
+			return b, errors.New("book not found or not deleted")
+		}
+		return b, errBookNotFound
+	}
+	return b, err
+}
+
+// lockMember locks a member for update, treating it as missing unless its
+// deleted state matches deleted
+func lockMember(ctx context.Context, tx repository.Store, id int, deleted bool) (models.Member, error) {
+	m, err := tx.Members().GetForUpdate(ctx, id)
+	if errors.Is(err, repository.ErrNotFound) || (err == nil && (m.DeletedAt != nil) != deleted) {
+		if deleted {
+			return m, errors.New("member not found or not deleted")
+		}
+		return m, errMemberNotFound
+	}
+	return m, err
+}
+
+// deletedBy is the deleted_by value for a soft delete: the acting user, or
+// nil for API keys, which are identified in the audit log instead
+func deletedBy(ctx context.Context) *int {
+	if p, ok := auth.PrincipalFrom(ctx); ok && p.IsUser() {
+		id := p.UserID
+		return &id
+	}
+	return nil
+}
@@ -1,346 +1,598 @@
 package schema
 
 import (
-	"database/sql"
+	"context"
 	"errors"
+	"fmt"
+	"library-system/pkg/audit"
 	"library-system/pkg/auth"
-	"library-system/pkg/db"
+	"library-system/pkg/circulation"
+	"library-system/pkg/idempotency"
 	"library-system/pkg/models"
+	"library-system/pkg/repository"
+	"net/url"
+	"strconv"
+	"time"
 
 	"github.com/graphql-go/graphql"
 )
 
-// RootQuery defines the read operations
-var RootQuery = graphql.NewObject(graphql.ObjectConfig{
-	Name: "RootQuery",
-	Fields: graphql.Fields{
-		"members": &graphql.Field{
-			Type: graphql.NewList(MemberType),
-			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
-				role := auth.GetRoleFromContext(p.Context)
-				if role != "ADMIN" && role != "LIBRARIAN" {
-					return nil, errors.New("forbidden: insufficient permissions to view members")
-				}
-				rows, err := db.DB.Query("SELECT id, name, email, joined_at FROM members")
-				if err != nil {
-					return nil, err
-				}
-				defer rows.Close()
-				var members []models.Member
-				for rows.Next() {
-					var m models.Member
-					if err := rows.Scan(&m.ID, &m.Name, &m.Email, &m.JoinedAt); err != nil {
-						return nil, err
+// DefaultResolverTimeout bounds each top-level field, including its transaction
+const DefaultResolverTimeout = 10 * time.Second
+
+// Config tunes the resolvers; see package config for where the values come from
+type Config struct {
+	ResolverTimeout time.Duration // Deadline for each top-level field; 0 leaves only the request's own deadline
+	IdempotencyTTL  time.Duration // Replay window of idempotency keys
+}
+
+// New builds the library schema with resolvers backed by store. Borrowing,
+// returning and renewing go through loans.
+func New(store repository.Store, loans *circulation.Service, cfg Config) (graphql.Schema, error) {
+	query := newRootQuery(store)
+	mutation := newRootMutation(store, loans, cfg)
+	for _, root := range []*graphql.Object{query, mutation} {
+		for _, field := range root.Fields() {
+			field.Resolve = withDeadline(field.Resolve, cfg.ResolverTimeout)
+		}
+	}
+	return graphql.NewSchema(graphql.SchemaConfig{
+		Query:    query,
+		Mutation: mutation,
+	})
+}
+
+// withDeadline runs resolve under timeout, unless it is 0, and reports
+// timeouts and cancellation with their error codes. Nested fields read the
+// values the top-level resolver loaded and need no deadline of their own.
+func withDeadline(resolve graphql.FieldResolveFn, timeout time.Duration) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		if timeout > 0 {
+			ctx, cancel := context.WithTimeout(p.Context, timeout)
+			defer cancel()
+			p.Context = ctx
+		}
+		v, err := resolve(p)
+		if err != nil {
+			return nil, timeoutError(p.Context, err)
+		}
+		return v, nil
+	}
+}
+
+// newRootQuery defines the read operations
+func newRootQuery(store repository.Store) *graphql.Object {
+	return graphql.NewObject(graphql.ObjectConfig{
+		Name: "RootQuery",
+		Fields: graphql.Fields{
+			"members": &graphql.Field{
+				Type: graphql.NewList(MemberType),
+				Args: graphql.FieldConfigArgument{
+					"include_deleted": &graphql.ArgumentConfig{Type: graphql.Boolean, DefaultValue: false, Description: "Also return soft-deleted members; requires members:write"},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if !auth.HasPermission(p.Context, auth.PermMembersRead) {
+						return nil, errors.New("forbidden: insufficient permissions to view members")
 					}
-					members = append(members, m)
-				}
-				return members, nil
-			},
-		},
-		"books": &graphql.Field{
-			Type: graphql.NewList(BookType),
-			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
-				// All authenticated users can view books
-				rows, err := db.DB.Query("SELECT id, title, author, published_year, total_copies, available_copies FROM books")
-				if err != nil {
-					return nil, err
-				}
-				defer rows.Close()
-				var books []models.Book
-				for rows.Next() {
-					var b models.Book
-					if err := rows.Scan(&b.ID, &b.Title, &b.Author, &b.PublishedYear, &b.TotalCopies, &b.AvailableCopies); err != nil {
-						return nil, err
+					includeDeleted := p.Args["include_deleted"].(bool)
+					if includeDeleted && !auth.HasPermission(p.Context, auth.PermMembersWrite) {
+						return nil, errors.New("forbidden: only ADMIN can view deleted members")
 					}
-					books = append(books, b)
-				}
-				return books, nil
+					return store.Members().List(p.Context, includeDeleted)
+				},
 			},
-		},
-		"borrows": &graphql.Field{
-			Type: graphql.NewList(BorrowType),
-			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
-				role := auth.GetRoleFromContext(p.Context)
-				if role != "ADMIN" && role != "LIBRARIAN" {
-					return nil, errors.New("forbidden: insufficient permissions to view borrow history")
-				}
-				rows, err := db.DB.Query("SELECT id, member_id, book_id, borrow_date, return_date, status FROM borrow")
-				if err != nil {
-					return nil, err
-				}
-				defer rows.Close()
-				var borrows []models.Borrow
-				for rows.Next() {
-					var b models.Borrow
-					var returnDate sql.NullTime
-					if err := rows.Scan(&b.ID, &b.MemberID, &b.BookID, &b.BorrowDate, &returnDate, &b.Status); err != nil {
-						return nil, err
+			"books": &graphql.Field{
+				Type: graphql.NewList(BookType),
+				Args: graphql.FieldConfigArgument{
+					"include_deleted": &graphql.ArgumentConfig{Type: graphql.Boolean, DefaultValue: false, Description: "Also return soft-deleted books; requires books:write"},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					// Every user role can view books; API keys need books:read
+					if !auth.HasPermission(p.Context, auth.PermBooksRead) {
+						return nil, errors.New("forbidden: insufficient permissions to view books")
 					}
-					if returnDate.Valid {
-						b.ReturnDate = &returnDate.Time
+					includeDeleted := p.Args["include_deleted"].(bool)
+					if includeDeleted && !auth.HasPermission(p.Context, auth.PermBooksWrite) {
+						return nil, errors.New("forbidden: only ADMIN can view deleted books")
 					}
-					borrows = append(borrows, b)
-				}
-				return borrows, nil
+					return store.Books().List(p.Context, includeDeleted)
+				},
 			},
-		},
-	},
-})
-
-// RootMutation defines the write operations
-var RootMutation = graphql.NewObject(graphql.ObjectConfig{
-	Name: "RootMutation",
-	Fields: graphql.Fields{
-		"createMember": &graphql.Field{
-			Type: MemberType,
-			Args: graphql.FieldConfigArgument{
-				"name":  &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
-				"email": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+			"borrows": &graphql.Field{
+				Type: graphql.NewList(BorrowType),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if !auth.HasPermission(p.Context, auth.PermBorrowsRead) {
+						return nil, errors.New("forbidden: insufficient permissions to view borrow history")
+					}
+					return store.Borrows().List(p.Context)
+				},
 			},
-			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
-				role := auth.GetRoleFromContext(p.Context)
-				if role != "ADMIN" {
-					return nil, errors.New("forbidden: only ADMIN can manage members")
-				}
-				name := p.Args["name"].(string)
-				email := p.Args["email"].(string)
-				var m models.Member
-				err := db.DB.QueryRow("INSERT INTO members (name, email) VALUES ($1, $2) RETURNING id, name, email, joined_at", name, email).Scan(&m.ID, &m.Name, &m.Email, &m.JoinedAt)
-				if err != nil {
-					return nil, err
-				}
-				return m, nil
+			"apiKeys": &graphql.Field{
+				Type: graphql.NewList(APIKeyType),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if !auth.HasPermission(p.Context, auth.PermAPIKeysManage) {
+						return nil, errors.New("forbidden: only ADMIN can manage API keys")
+					}
+					return store.APIKeys().List(p.Context)
+				},
+			},
+			"auditLog": &graphql.Field{
+				Type:        AuditLogPageType,
+				Description: "Audit log entries, newest first. The same filter is accepted as query parameters by GET /admin/audit-log.csv.",
+				Args: graphql.FieldConfigArgument{
+					"filter": &graphql.ArgumentConfig{Type: AuditLogFilterInput},
+					"first":  &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 50},
+					"after":  &graphql.ArgumentConfig{Type: graphql.String},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if !auth.HasPermission(p.Context, auth.PermAuditRead) {
+						return nil, errors.New("forbidden: only ADMIN can read the audit log")
+					}
+
+					// The filter input uses the same names as the CSV export's query parameters
+					values := url.Values{}
+					if filter, ok := p.Args["filter"].(map[string]interface{}); ok {
+						for k, v := range filter {
+							if v != nil {
+								values.Set(k, fmt.Sprint(v))
+							}
+						}
+					}
+					f, err := audit.FilterFromQuery(values)
+					if err != nil {
+						return nil, err
+					}
+
+					var afterID int64
+					if after, ok := p.Args["after"].(string); ok && after != "" {
+						afterID, err = strconv.ParseInt(after, 10, 64)
+						if err != nil {
+							return nil, errors.New("invalid cursor")
+						}
+					}
+
+					entries, next, err := audit.List(p.Context, store.AuditLog(), f, p.Args["first"].(int), afterID)
+					if err != nil {
+						return nil, err
+					}
+					total, err := store.AuditLog().Count(p.Context, f)
+					if err != nil {
+						return nil, err
+					}
+
+					page := map[string]interface{}{"entries": entries, "total_count": total, "next_cursor": nil}
+					if next != 0 {
+						page["next_cursor"] = strconv.FormatInt(next, 10)
+					}
+					return page, nil
+				},
 			},
 		},
-		"updateMember": &graphql.Field{
-			Type: MemberType,
-			Args: graphql.FieldConfigArgument{
-				"id":    &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
-				"name":  &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
-				"email": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+	})
+}
+
+// newRootMutation defines the write operations
+func newRootMutation(store repository.Store, loans *circulation.Service, cfg Config) *graphql.Object {
+	return graphql.NewObject(graphql.ObjectConfig{
+		Name: "RootMutation",
+		Fields: graphql.Fields{
+			"createMember": &graphql.Field{
+				Type: MemberType,
+				Args: graphql.FieldConfigArgument{
+					"name":  &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+					"email": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if !auth.HasPermission(p.Context, auth.PermMembersWrite) {
+						return nil, errors.New("forbidden: only ADMIN can manage members")
+					}
+					name := p.Args["name"].(string)
+					email := p.Args["email"].(string)
+
+					return resolveInTx(p.Context, store, func(tx repository.Store) (models.Member, error) {
+						m, err := tx.Members().Create(p.Context, models.Member{Name: name, Email: email})
+						if err != nil {
+							return m, err
+						}
+						return m, audit.Record(p.Context, tx.AuditLog(), "createMember", "member", m.ID, nil, m)
+					})
+				},
 			},
-			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
-				role := auth.GetRoleFromContext(p.Context)
-				if role != "ADMIN" {
-					return nil, errors.New("forbidden: only ADMIN can manage members")
-				}
-				id := p.Args["id"].(int)
-				name := p.Args["name"].(string)
-				email := p.Args["email"].(string)
-				var m models.Member
-				err := db.DB.QueryRow("UPDATE members SET name = $1, email = $2 WHERE id = $3 RETURNING id, name, email, joined_at", name, email, id).Scan(&m.ID, &m.Name, &m.Email, &m.JoinedAt)
-				if err != nil {
-					return nil, err
-				}
-				return m, nil
+			"updateMember": &graphql.Field{
+				Type: MemberType,
+				Args: graphql.FieldConfigArgument{
+					"id":               &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+					"name":             &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+					"email":            &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+					"expected_version": &graphql.ArgumentConfig{Type: graphql.Int, Description: "Fail with a CONFLICT error if the member's version differs"},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if !auth.HasPermission(p.Context, auth.PermMembersWrite) {
+						return nil, errors.New("forbidden: only ADMIN can manage members")
+					}
+					id := p.Args["id"].(int)
+					name := p.Args["name"].(string)
+					email := p.Args["email"].(string)
+
+					return resolveInTx(p.Context, store, func(tx repository.Store) (models.Member, error) {
+						before, err := lockMember(p.Context, tx, id, false)
+						if err != nil {
+							return before, err
+						}
+						if err := checkVersion(p.Args, "member", id, before.Version); err != nil {
+							return before, err
+						}
+
+						m := before
+						m.Name, m.Email = name, email
+						m, err = tx.Members().Update(p.Context, m)
+						if err != nil {
+							return m, err
+						}
+						return m, audit.Record(p.Context, tx.AuditLog(), "updateMember", "member", m.ID, before, m)
+					})
+				},
 			},
-		},
-		"deleteMember": &graphql.Field{
-			Type: MemberType,
-			Args: graphql.FieldConfigArgument{
-				"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+			"deleteMember": &graphql.Field{
+				Type: MemberType,
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if !auth.HasPermission(p.Context, auth.PermMembersWrite) {
+						return nil, errors.New("forbidden: only ADMIN can manage members")
+					}
+					id := p.Args["id"].(int)
+
+					return resolveInTx(p.Context, store, func(tx repository.Store) (models.Member, error) {
+						before, err := lockMember(p.Context, tx, id, false)
+						if err != nil {
+							return before, err
+						}
+
+						activeLoans, err := tx.Borrows().CountActiveByMember(p.Context, id)
+						if err != nil {
+							return before, err
+						}
+						if activeLoans > 0 {
+							return before, errors.New("cannot delete member with active loans")
+						}
+
+						m, err := tx.Members().SoftDelete(p.Context, id, deletedBy(p.Context))
+						if err != nil {
+							return m, err
+						}
+						return m, audit.Record(p.Context, tx.AuditLog(), "deleteMember", "member", m.ID, before, m)
+					})
+				},
 			},
-			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
-				role := auth.GetRoleFromContext(p.Context)
-				if role != "ADMIN" {
-					return nil, errors.New("forbidden: only ADMIN can manage members")
-				}
-				id := p.Args["id"].(int)
-				var m models.Member
-				err := db.DB.QueryRow("DELETE FROM members WHERE id = $1 RETURNING id, name, email, joined_at", id).Scan(&m.ID, &m.Name, &m.Email, &m.JoinedAt)
-				if err != nil {
-					return nil, err
-				}
-				return m, nil
+			"restoreMember": &graphql.Field{
+				Type: MemberType,
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if !auth.HasPermission(p.Context, auth.PermMembersWrite) {
+						return nil, errors.New("forbidden: only ADMIN can manage members")
+					}
+					id := p.Args["id"].(int)
+
+					return resolveInTx(p.Context, store, func(tx repository.Store) (models.Member, error) {
+						before, err := lockMember(p.Context, tx, id, true)
+						if err != nil {
+							return before, err
+						}
+
+						m, err := tx.Members().Restore(p.Context, id)
+						if err != nil {
+							return m, err
+						}
+						return m, audit.Record(p.Context, tx.AuditLog(), "restoreMember", "member", m.ID, before, m)
+					})
+				},
 			},
-		},
-		"createBook": &graphql.Field{
-			Type: BookType,
-			Args: graphql.FieldConfigArgument{
-				"title":          &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
-				"author":         &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
-				"published_year": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
-				"total_copies":   &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+			"createLocalAccount": &graphql.Field{
+				Type: UserType,
+				Args: graphql.FieldConfigArgument{
+					"email":    &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+					"name":     &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+					"password": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if !auth.HasPermission(p.Context, auth.PermAccountsManage) {
+						return nil, errors.New("forbidden: only ADMIN can manage accounts")
+					}
+					provider, _ := auth.GetProvider("local")
+					local, ok := provider.(*auth.LocalProvider)
+					if !ok {
+						return nil, errors.New("local accounts are not enabled")
+					}
+					email := p.Args["email"].(string)
+					name := p.Args["name"].(string)
+					password := p.Args["password"].(string)
+
+					hash, err := local.NewPasswordHash(password)
+					if err != nil {
+						return nil, err
+					}
+					return resolveInTx(p.Context, store, func(tx repository.Store) (models.User, error) {
+						// Never adds a password to an existing account, which would give
+						// a Google or OIDC user a second way to sign in
+						id, err := tx.Users().CreateLocal(p.Context, email, name, hash)
+						if errors.Is(err, repository.ErrDuplicateEmail) {
+							return models.User{}, fmt.Errorf("an account with email %s already exists", email)
+						}
+						if err != nil {
+							return models.User{}, err
+						}
+						u, err := tx.Users().Get(p.Context, id)
+						if err != nil {
+							return u, err
+						}
+						return u, audit.Record(p.Context, tx.AuditLog(), "createLocalAccount", "user", u.ID, nil, u)
+					})
+				},
 			},
-			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
-				role := auth.GetRoleFromContext(p.Context)
-				if role != "ADMIN" {
-					return nil, errors.New("forbidden: only ADMIN can add books")
-				}
-				title := p.Args["title"].(string)
-				author := p.Args["author"].(string)
-				pubYear := p.Args["published_year"].(int)
-				totalCopies := p.Args["total_copies"].(int)
-
-				var b models.Book
-				err := db.DB.QueryRow("INSERT INTO books (title, author, published_year, total_copies, available_copies) VALUES ($1, $2, $3, $4, $4) RETURNING id, title, author, published_year, total_copies, available_copies", title, author, pubYear, totalCopies).Scan(&b.ID, &b.Title, &b.Author, &b.PublishedYear, &b.TotalCopies, &b.AvailableCopies)
-				if err != nil {
-					return nil, err
-				}
-				return b, nil
+			"createApiKey": &graphql.Field{
+				Type: APIKeyCreatedType,
+				Args: graphql.FieldConfigArgument{
+					"name":        &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+					"permissions": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(graphql.String)))},
+					"expires_at":  &graphql.ArgumentConfig{Type: graphql.String, Description: "RFC 3339 timestamp; omit for a key that does not expire"},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if !auth.HasPermission(p.Context, auth.PermAPIKeysManage) {
+						return nil, errors.New("forbidden: only ADMIN can manage API keys")
+					}
+					name := p.Args["name"].(string)
+					var permissions []string
+					for _, perm := range p.Args["permissions"].([]interface{}) {
+						permissions = append(permissions, perm.(string))
+					}
+					var expiresAt *time.Time
+					if v, ok := p.Args["expires_at"].(string); ok && v != "" {
+						t, err := time.Parse(time.RFC3339, v)
+						if err != nil {
+							return nil, errors.New("expires_at must be an RFC 3339 timestamp")
+						}
+						expiresAt = &t
+					}
+					principal, _ := auth.PrincipalFrom(p.Context)
+
+					return resolveInTx(p.Context, store, func(tx repository.Store) (map[string]interface{}, error) {
+						key, k, err := auth.CreateAPIKey(p.Context, tx.APIKeys(), name, permissions, expiresAt, principal.UserID)
+						if err != nil {
+							return nil, err
+						}
+						if err := audit.Record(p.Context, tx.AuditLog(), "createApiKey", "api_key", k.ID, nil, k); err != nil {
+							return nil, err
+						}
+						return map[string]interface{}{"key": key, "api_key": k}, nil
+					})
+				},
 			},
-		},
-		"updateBook": &graphql.Field{
-			Type: BookType,
-			Args: graphql.FieldConfigArgument{
-				"id":             &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
-				"title":          &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
-				"author":         &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
-				"published_year": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
-				"total_copies":   &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+			"revokeApiKey": &graphql.Field{
+				Type: APIKeyType,
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if !auth.HasPermission(p.Context, auth.PermAPIKeysManage) {
+						return nil, errors.New("forbidden: only ADMIN can manage API keys")
+					}
+					id := p.Args["id"].(int)
+					return resolveInTx(p.Context, store, func(tx repository.Store) (models.APIKey, error) {
+						before, err := tx.APIKeys().GetForUpdate(p.Context, id)
+						if err != nil {
+							return before, err
+						}
+						k, err := tx.APIKeys().Revoke(p.Context, id)
+						if err != nil {
+							return k, err
+						}
+						return k, audit.Record(p.Context, tx.AuditLog(), "revokeApiKey", "api_key", k.ID, before, k)
+					})
+				},
 			},
-			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
-				role := auth.GetRoleFromContext(p.Context)
-				if role != "ADMIN" {
-					return nil, errors.New("forbidden: only ADMIN can update books")
-				}
-				id := p.Args["id"].(int)
-				title := p.Args["title"].(string)
-				author := p.Args["author"].(string)
-				pubYear := p.Args["published_year"].(int)
-				totalCopies := p.Args["total_copies"].(int)
-
-				// Calculate difference in copies to update available copies
-				var currentTotal int
-				err := db.DB.QueryRow("SELECT total_copies FROM books WHERE id = $1", id).Scan(&currentTotal)
-				if err != nil {
-					return nil, err
-				}
-				diff := totalCopies - currentTotal
-
-				var b models.Book
-				err = db.DB.QueryRow("UPDATE books SET title = $1, author = $2, published_year = $3, total_copies = $4, available_copies = available_copies + $5 WHERE id = $6 RETURNING id, title, author, published_year, total_copies, available_copies", title, author, pubYear, totalCopies, diff, id).Scan(&b.ID, &b.Title, &b.Author, &b.PublishedYear, &b.TotalCopies, &b.AvailableCopies)
-				if err != nil {
-					return nil, err
-				}
-				return b, nil
+			"createBook": &graphql.Field{
+				Type: BookType,
+				Args: graphql.FieldConfigArgument{
+					"title":          &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+					"author":         &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+					"published_year": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+					"total_copies":   &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if !auth.HasPermission(p.Context, auth.PermBooksWrite) {
+						return nil, errors.New("forbidden: only ADMIN can add books")
+					}
+					in := models.Book{
+						Title:         p.Args["title"].(string),
+						Author:        p.Args["author"].(string),
+						PublishedYear: p.Args["published_year"].(int),
+						TotalCopies:   p.Args["total_copies"].(int),
+					}
+
+					return resolveInTx(p.Context, store, func(tx repository.Store) (models.Book, error) {
+						b, err := tx.Books().Create(p.Context, in)
+						if err != nil {
+							return b, err
+						}
+						return b, audit.Record(p.Context, tx.AuditLog(), "createBook", "book", b.ID, nil, b)
+					})
+				},
 			},
-		},
-		"deleteBook": &graphql.Field{
-			Type: BookType,
-			Args: graphql.FieldConfigArgument{
-				"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+			"updateBook": &graphql.Field{
+				Type: BookType,
+				Args: graphql.FieldConfigArgument{
+					"id":               &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+					"title":            &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+					"author":           &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+					"published_year":   &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+					"total_copies":     &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+					"expected_version": &graphql.ArgumentConfig{Type: graphql.Int, Description: "Fail with a CONFLICT error if the book's version differs"},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if !auth.HasPermission(p.Context, auth.PermBooksWrite) {
+						return nil, errors.New("forbidden: only ADMIN can update books")
+					}
+					id := p.Args["id"].(int)
+					totalCopies := p.Args["total_copies"].(int)
+
+					return resolveInTx(p.Context, store, func(tx repository.Store) (models.Book, error) {
+						before, err := lockBook(p.Context, tx, id, false)
+						if err != nil {
+							return before, err
+						}
+						if err := checkVersion(p.Args, "book", id, before.Version); err != nil {
+							return before, err
+						}
+
+						// Calculate difference in copies to update available copies. The row is
+						// locked, so concurrent borrows and returns cannot skew the result.
+						diff := totalCopies - before.TotalCopies
+						if before.AvailableCopies+diff < 0 {
+							return before, fmt.Errorf("total_copies cannot be less than the %d copies on loan", before.TotalCopies-before.AvailableCopies)
+						}
+
+						b := before
+						b.Title = p.Args["title"].(string)
+						b.Author = p.Args["author"].(string)
+						b.PublishedYear = p.Args["published_year"].(int)
+						b.TotalCopies = totalCopies
+						b.AvailableCopies += diff
+						b, err = tx.Books().Update(p.Context, b)
+						if err != nil {
+							return b, err
+						}
+						return b, audit.Record(p.Context, tx.AuditLog(), "updateBook", "book", b.ID, before, b)
+					})
+				},
 			},
-			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
-				role := auth.GetRoleFromContext(p.Context)
-				if role != "ADMIN" {
-					return nil, errors.New("forbidden: only ADMIN can delete books")
-				}
-				id := p.Args["id"].(int)
-				var b models.Book
-				err := db.DB.QueryRow("DELETE FROM books WHERE id = $1 RETURNING id, title, author, published_year, total_copies, available_copies", id).Scan(&b.ID, &b.Title, &b.Author, &b.PublishedYear, &b.TotalCopies, &b.AvailableCopies)
-				if err != nil {
-					return nil, err
-				}
-				return b, nil
+			"deleteBook": &graphql.Field{
+				Type: BookType,
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if !auth.HasPermission(p.Context, auth.PermBooksWrite) {
+						return nil, errors.New("forbidden: only ADMIN can delete books")
+					}
+					id := p.Args["id"].(int)
+
+					return resolveInTx(p.Context, store, func(tx repository.Store) (models.Book, error) {
+						before, err := lockBook(p.Context, tx, id, false)
+						if err != nil {
+							return before, err
+						}
+
+						activeLoans, err := tx.Borrows().CountActiveByBook(p.Context, id)
+						if err != nil {
+							return before, err
+						}
+						if activeLoans > 0 {
+							return before, errors.New("cannot delete book with active loans")
+						}
+
+						b, err := tx.Books().SoftDelete(p.Context, id, deletedBy(p.Context))
+						if err != nil {
+							return b, err
+						}
+						return b, audit.Record(p.Context, tx.AuditLog(), "deleteBook", "book", b.ID, before, b)
+					})
+				},
 			},
-		},
-		"borrowBook": &graphql.Field{
-			Type: BorrowType,
-			Args: graphql.FieldConfigArgument{
-				"member_id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
-				"book_id":   &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+			"restoreBook": &graphql.Field{
+				Type: BookType,
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if !auth.HasPermission(p.Context, auth.PermBooksWrite) {
+						return nil, errors.New("forbidden: only ADMIN can restore books")
+					}
+					id := p.Args["id"].(int)
+
+					return resolveInTx(p.Context, store, func(tx repository.Store) (models.Book, error) {
+						before, err := lockBook(p.Context, tx, id, true)
+						if err != nil {
+							return before, err
+						}
+
+						b, err := tx.Books().Restore(p.Context, id)
+						if err != nil {
+							return b, err
+						}
+						return b, audit.Record(p.Context, tx.AuditLog(), "restoreBook", "book", b.ID, before, b)
+					})
+				},
 			},
-			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
-				role := auth.GetRoleFromContext(p.Context)
-				if role != "ADMIN" && role != "LIBRARIAN" {
-					return nil, errors.New("forbidden: only ADMIN or LIBRARIAN can issue books")
-				}
-				memberID := p.Args["member_id"].(int)
-				bookID := p.Args["book_id"].(int)
-
-				tx, err := db.DB.Begin()
-				if err != nil {
-					return nil, err
-				}
-				defer tx.Rollback()
-
-				// Check availability
-				var available int
-				err = tx.QueryRow("SELECT available_copies FROM books WHERE id = $1 FOR UPDATE", bookID).Scan(&available)
-				if err != nil {
-					return nil, err
-				}
-				if available <= 0 {
-					return nil, errors.New("book not available")
-				}
-
-				// Update book availability
-				_, err = tx.Exec("UPDATE books SET available_copies = available_copies - 1 WHERE id = $1", bookID)
-				if err != nil {
-					return nil, err
-				}
-
-				// Create borrow record
-				var b models.Borrow
-				err = tx.QueryRow("INSERT INTO borrow (member_id, book_id, status) VALUES ($1, $2, 'borrowed') RETURNING id, member_id, book_id, borrow_date, status", memberID, bookID).Scan(&b.ID, &b.MemberID, &b.BookID, &b.BorrowDate, &b.Status)
-				if err != nil {
-					return nil, err
-				}
-
-				if err := tx.Commit(); err != nil {
-					return nil, err
-				}
-				return b, nil
+			"borrowBook": &graphql.Field{
+				Type: BorrowType,
+				Args: graphql.FieldConfigArgument{
+					"member_id":       &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+					"book_id":         &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+					"idempotency_key": &graphql.ArgumentConfig{Type: graphql.String, Description: "Retries with the same key return the first result; defaults to the Idempotency-Key header"},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if !auth.HasPermission(p.Context, auth.PermCirculationWrite) {
+						return nil, errors.New("forbidden: only ADMIN or LIBRARIAN can issue books")
+					}
+					memberID := p.Args["member_id"].(int)
+					bookID := p.Args["book_id"].(int)
+
+					b, err := idempotency.Do(p.Context, store, cfg.IdempotencyTTL, idempotencyKey(p), "borrowBook", idempotentArgs(p.Args), func(tx repository.Store) (models.Borrow, error) {
+						return loans.WithStore(tx).Checkout(p.Context, memberID, bookID)
+					})
+					if err != nil {
+						return nil, circulationError(err)
+					}
+					return b, nil
+				},
 			},
-		},
-		"returnBook": &graphql.Field{
-			Type: BorrowType,
-			Args: graphql.FieldConfigArgument{
-				"borrow_id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+			"returnBook": &graphql.Field{
+				Type: BorrowType,
+				Args: graphql.FieldConfigArgument{
+					"borrow_id":       &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+					"idempotency_key": &graphql.ArgumentConfig{Type: graphql.String, Description: "Retries with the same key return the first result; defaults to the Idempotency-Key header"},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if !auth.HasPermission(p.Context, auth.PermCirculationWrite) {
+						return nil, errors.New("forbidden: only ADMIN or LIBRARIAN can return books")
+					}
+					borrowID := p.Args["borrow_id"].(int)
+
+					b, err := idempotency.Do(p.Context, store, cfg.IdempotencyTTL, idempotencyKey(p), "returnBook", idempotentArgs(p.Args), func(tx repository.Store) (models.Borrow, error) {
+						return loans.WithStore(tx).Checkin(p.Context, borrowID)
+					})
+					if err != nil {
+						return nil, circulationError(err)
+					}
+					return b, nil
+				},
 			},
-			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
-				role := auth.GetRoleFromContext(p.Context)
-				if role != "ADMIN" && role != "LIBRARIAN" {
-					return nil, errors.New("forbidden: only ADMIN or LIBRARIAN can return books")
-				}
-				borrowID := p.Args["borrow_id"].(int)
-
-				tx, err := db.DB.Begin()
-				if err != nil {
-					return nil, err
-				}
-				defer tx.Rollback()
-
-				// Get Borrow Record
-				var bookID int
-				var status string
-				err = tx.QueryRow("SELECT book_id, status FROM borrow WHERE id = $1 FOR UPDATE", borrowID).Scan(&bookID, &status)
-				if err != nil {
-					return nil, err
-				}
-
-				if status == "returned" {
-					return nil, errors.New("book already returned")
-				}
-
-				// Update Borrow Record
-				var b models.Borrow
-				var returnDate sql.NullTime
-				err = tx.QueryRow("UPDATE borrow SET status = 'returned', return_date = CURRENT_TIMESTAMP WHERE id = $1 RETURNING id, member_id, book_id, borrow_date, return_date, status", borrowID).Scan(&b.ID, &b.MemberID, &b.BookID, &b.BorrowDate, &returnDate, &b.Status)
-				if err != nil {
-					return nil, err
-				}
-				if returnDate.Valid {
-					b.ReturnDate = &returnDate.Time
-				}
-
-				// Update Book Availability
-				_, err = tx.Exec("UPDATE books SET available_copies = available_copies + 1 WHERE id = $1", bookID)
-				if err != nil {
-					return nil, err
-				}
-
-				if err := tx.Commit(); err != nil {
-					return nil, err
-				}
-				return b, nil
+			"renewBook": &graphql.Field{
+				Type:        BorrowType,
+				Description: "Extends an active loan by another loan period",
+				Args: graphql.FieldConfigArgument{
+					"borrow_id":       &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+					"idempotency_key": &graphql.ArgumentConfig{Type: graphql.String, Description: "Retries with the same key return the first result; defaults to the Idempotency-Key header"},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if !auth.HasPermission(p.Context, auth.PermCirculationWrite) {
+						return nil, errors.New("forbidden: only ADMIN or LIBRARIAN can renew loans")
+					}
+					borrowID := p.Args["borrow_id"].(int)
+
+					b, err := idempotency.Do(p.Context, store, cfg.IdempotencyTTL, idempotencyKey(p), "renewBook", idempotentArgs(p.Args), func(tx repository.Store) (models.Borrow, error) {
+						return loans.WithStore(tx).Renew(p.Context, borrowID)
+					})
+					if err != nil {
+						return nil, circulationError(err)
+					}
+					return b, nil
+				},
 			},
 		},
-	},
-})
-
-var LibrarySchema, _ = graphql.NewSchema(graphql.SchemaConfig{
-	Query:    RootQuery,
-	Mutation: RootMutation,
-})
+	})
+}
@@ -8,10 +8,13 @@ import (
 var MemberType = graphql.NewObject(graphql.ObjectConfig{
 	Name: "Member",
 	Fields: graphql.Fields{
-		"id":        &graphql.Field{Type: graphql.Int},
-		"name":      &graphql.Field{Type: graphql.String},
-		"email":     &graphql.Field{Type: graphql.String},
-		"joined_at": &graphql.Field{Type: graphql.String},
+		"id":         &graphql.Field{Type: graphql.Int},
+		"name":       &graphql.Field{Type: graphql.String},
+		"email":      &graphql.Field{Type: graphql.String},
+		"joined_at":  &graphql.Field{Type: graphql.String},
+		"version":    &graphql.Field{Type: graphql.Int, Description: "Pass as expected_version to updateMember to detect concurrent edits"},
+		"deleted_at": &graphql.Field{Type: graphql.String},
+		"deleted_by": &graphql.Field{Type: graphql.Int},
 	},
 })
 
@@ -25,6 +28,9 @@ var BookType = graphql.NewObject(graphql.ObjectConfig{
 		"published_year":   &graphql.Field{Type: graphql.Int},
 		"total_copies":     &graphql.Field{Type: graphql.Int},
 		"available_copies": &graphql.Field{Type: graphql.Int},
+		"version":          &graphql.Field{Type: graphql.Int, Description: "Pass as expected_version to updateBook to detect concurrent edits"},
+		"deleted_at":       &graphql.Field{Type: graphql.String},
+		"deleted_by":       &graphql.Field{Type: graphql.Int},
 	},
 })
 
@@ -36,7 +42,90 @@ var BorrowType = graphql.NewObject(graphql.ObjectConfig{
 		"member_id":   &graphql.Field{Type: graphql.Int},
 		"book_id":     &graphql.Field{Type: graphql.Int},
 		"borrow_date": &graphql.Field{Type: graphql.String},
+		"due_date":    &graphql.Field{Type: graphql.String},
 		"return_date": &graphql.Field{Type: graphql.String},
 		"status":      &graphql.Field{Type: graphql.String},
+		"renewals":    &graphql.Field{Type: graphql.Int},
+	},
+})
+
+// UserType defines the GraphQL object for a login account
+var UserType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "User",
+	Fields: graphql.Fields{
+		"id":         &graphql.Field{Type: graphql.Int},
+		"email":      &graphql.Field{Type: graphql.String},
+		"name":       &graphql.Field{Type: graphql.String},
+		"avatar_url": &graphql.Field{Type: graphql.String},
+		"role":       &graphql.Field{Type: graphql.String},
+		"provider":   &graphql.Field{Type: graphql.String},
+	},
+})
+
+// APIKeyType defines the GraphQL object for a service account API key
+var APIKeyType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "ApiKey",
+	Fields: graphql.Fields{
+		"id":           &graphql.Field{Type: graphql.Int},
+		"name":         &graphql.Field{Type: graphql.String},
+		"prefix":       &graphql.Field{Type: graphql.String},
+		"permissions":  &graphql.Field{Type: graphql.NewList(graphql.String)},
+		"created_by":   &graphql.Field{Type: graphql.Int},
+		"created_at":   &graphql.Field{Type: graphql.String},
+		"expires_at":   &graphql.Field{Type: graphql.String},
+		"revoked_at":   &graphql.Field{Type: graphql.String},
+		"last_used_at": &graphql.Field{Type: graphql.String},
+	},
+})
+
+// APIKeyCreatedType is returned once when a key is created; "key" is never retrievable again
+var APIKeyCreatedType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "ApiKeyCreated",
+	Fields: graphql.Fields{
+		"key":     &graphql.Field{Type: graphql.String},
+		"api_key": &graphql.Field{Type: APIKeyType},
+	},
+})
+
+// AuditEntryType defines the GraphQL object for an audit log entry
+var AuditEntryType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "AuditEntry",
+	Fields: graphql.Fields{
+		"id":               &graphql.Field{Type: graphql.Int},
+		"occurred_at":      &graphql.Field{Type: graphql.String},
+		"actor":            &graphql.Field{Type: graphql.String},
+		"actor_user_id":    &graphql.Field{Type: graphql.Int},
+		"actor_api_key_id": &graphql.Field{Type: graphql.Int},
+		"action":           &graphql.Field{Type: graphql.String},
+		"entity_type":      &graphql.Field{Type: graphql.String},
+		"entity_id":        &graphql.Field{Type: graphql.String},
+		"before":           &graphql.Field{Type: graphql.String, Description: "JSON snapshot before the change"},
+		"after":            &graphql.Field{Type: graphql.String, Description: "JSON snapshot after the change"},
+		"request_id":       &graphql.Field{Type: graphql.String},
+		"ip":               &graphql.Field{Type: graphql.String},
+	},
+})
+
+// AuditLogPageType is one page of audit log entries, newest first
+var AuditLogPageType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "AuditLogPage",
+	Fields: graphql.Fields{
+		"entries":     &graphql.Field{Type: graphql.NewList(AuditEntryType)},
+		"total_count": &graphql.Field{Type: graphql.Int},
+		"next_cursor": &graphql.Field{Type: graphql.String, Description: "Pass as `after` to fetch the next page; null on the last page"},
+	},
+})
+
+// AuditLogFilterInput narrows an auditLog query
+var AuditLogFilterInput = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name: "AuditLogFilter",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"actor_user_id": &graphql.InputObjectFieldConfig{Type: graphql.Int},
+		"action":        &graphql.InputObjectFieldConfig{Type: graphql.String},
+		"entity_type":   &graphql.InputObjectFieldConfig{Type: graphql.String},
+		"entity_id":     &graphql.InputObjectFieldConfig{Type: graphql.String},
+		"request_id":    &graphql.InputObjectFieldConfig{Type: graphql.String},
+		"from":          &graphql.InputObjectFieldConfig{Type: graphql.String, Description: "RFC 3339 timestamp, inclusive"},
+		"to":            &graphql.InputObjectFieldConfig{Type: graphql.String, Description: "RFC 3339 timestamp, exclusive"},
 	},
 })
@@ -0,0 +1,162 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// GraphQL is a graphql-go extension that wraps each operation in a span with
+// a child span per resolved field, and adds the trace ID to the extensions
+// of execution errors. Add it with Schema.AddExtensions.
+type GraphQL struct{}
+
+var _ graphql.Extension = GraphQL{}
+
+type operationKey struct{}
+
+// operation is the span covering one request from parsing to the result
+type operation struct {
+	span  trace.Span
+	named bool
+}
+
+func (GraphQL) Name() string {
+	return "tracing"
+}
+
+func (GraphQL) Init(ctx context.Context, p *graphql.Params) context.Context {
+	ctx, span := tracer.Start(ctx, "GraphQL Operation")
+	if p.OperationName != "" {
+		span.SetAttributes(semconv.GraphQLOperationName(p.OperationName))
+	}
+	return context.WithValue(ctx, operationKey{}, &operation{span: span})
+}
+
+func (GraphQL) ParseDidStart(ctx context.Context) (context.Context, graphql.ParseFinishFunc) {
+	return ctx, func(err error) {
+		if err != nil {
+			endOperation(ctx, "parse failed", err)
+		}
+	}
+}
+
+func (GraphQL) ValidationDidStart(ctx context.Context) (context.Context, graphql.ValidationFinishFunc) {
+	return ctx, func(errs []gqlerrors.FormattedError) {
+		if len(errs) > 0 {
+			endOperation(ctx, "validation failed", errs[0])
+		}
+	}
+}
+
+func (GraphQL) ExecutionDidStart(ctx context.Context) (context.Context, graphql.ExecutionFinishFunc) {
+	return ctx, func(result *graphql.Result) {
+		traceID := TraceID(ctx)
+		for i := range result.Errors {
+			if result.Errors[i].Extensions == nil {
+				result.Errors[i].Extensions = map[string]interface{}{}
+			}
+			result.Errors[i].Extensions["trace_id"] = traceID
+		}
+		if len(result.Errors) > 0 {
+			endOperation(ctx, result.Errors[0].Message, nil)
+			return
+		}
+		endOperation(ctx, "", nil)
+	}
+}
+
+// ResolveFieldDidStart traces fields with their own resolver; fields served
+// by the default resolver only read a struct and would flood the trace.
+func (GraphQL) ResolveFieldDidStart(ctx context.Context, info *graphql.ResolveInfo) (context.Context, graphql.ResolveFieldFinishFunc) {
+	op, ok := ctx.Value(operationKey{}).(*operation)
+	if !ok || !hasResolver(info) {
+		return ctx, func(interface{}, error) {}
+	}
+	if !op.named {
+		op.named = true
+		nameOperation(op.span, info)
+	}
+
+	// graphql-go hands the context returned here to the following sibling
+	// fields too, so parent every field on the operation span explicitly
+	field := info.ParentType.Name() + "." + info.FieldName
+	ctx, span := tracer.Start(trace.ContextWithSpan(ctx, op.span), field,
+		trace.WithAttributes(
+			attribute.String("graphql.field.name", info.FieldName),
+			attribute.String("graphql.field.path", fieldPath(info.Path)),
+		),
+	)
+	return ctx, func(_ interface{}, err error) {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+}
+
+func (GraphQL) HasResult() bool {
+	return false
+}
+
+func (GraphQL) GetResult(context.Context) interface{} {
+	return nil
+}
+
+// endOperation ends the operation span, marking it failed unless msg is empty
+func endOperation(ctx context.Context, msg string, err error) {
+	op, ok := ctx.Value(operationKey{}).(*operation)
+	if !ok {
+		return
+	}
+	if err != nil {
+		op.span.RecordError(err)
+	}
+	if msg != "" {
+		op.span.SetStatus(codes.Error, msg)
+	}
+	op.span.End()
+}
+
+// nameOperation renames the operation span after the parsed document, e.g. "mutation Borrow"
+func nameOperation(span trace.Span, info *graphql.ResolveInfo) {
+	def, ok := info.Operation.(*ast.OperationDefinition)
+	if !ok {
+		return
+	}
+	span.SetAttributes(semconv.GraphQLOperationTypeKey.String(def.Operation))
+	if def.Name == nil {
+		span.SetName(def.Operation)
+		return
+	}
+	span.SetName(def.Operation + " " + def.Name.Value)
+	span.SetAttributes(semconv.GraphQLOperationName(def.Name.Value))
+}
+
+// hasResolver reports whether the field defines its own Resolve function
+func hasResolver(info *graphql.ResolveInfo) bool {
+	obj, ok := info.ParentType.(*graphql.Object)
+	if !ok {
+		return false
+	}
+	def, ok := obj.Fields()[info.FieldName]
+	return ok && def.Resolve != nil
+}
+
+// fieldPath formats a response path, e.g. books.0.title
+func fieldPath(p *graphql.ResponsePath) string {
+	var keys []string
+	for ; p != nil; p = p.Prev {
+		keys = append([]string{fmt.Sprint(p.Key)}, keys...)
+	}
+	return strings.Join(keys, ".")
+}
@@ -0,0 +1,56 @@
+package tracing
+
+import (
+	"net/http"
+
+	"library-system/pkg/httpx"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TraceIDHeader carries the trace ID on every response, so clients can quote it
+const TraceIDHeader = "X-Trace-ID"
+
+// Middleware starts a server span per request, continuing the trace named by
+// an incoming traceparent header. Register it with mux's Router.Use after
+// httpx.RequestMetadata so the route template names the span.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+		route := r.URL.Path
+		if current := mux.CurrentRoute(r); current != nil {
+			if tpl, err := current.GetPathTemplate(); err == nil {
+				route = tpl
+			}
+		}
+		ctx, span := tracer.Start(ctx, r.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(r.Method),
+				semconv.HTTPRoute(route),
+				semconv.URLPath(r.URL.Path),
+				semconv.ClientAddress(httpx.ClientIPFrom(ctx)),
+				attribute.String("http.request.id", httpx.RequestIDFrom(ctx)),
+			),
+		)
+		defer span.End()
+
+		if id := TraceID(ctx); id != "" {
+			w.Header().Set(TraceIDHeader, id)
+		}
+		rec := httpx.NewResponseRecorder(w)
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		span.SetAttributes(semconv.HTTPResponseStatusCode(rec.Status))
+		if rec.Status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(rec.Status))
+		}
+	})
+}
@@ -1,39 +0,0 @@
-package main
-
-import (
-	"database/sql"
-	"fmt"
-	"log"
-	"os"
-	"path/filepath"
-
-	"github.com/joho/godotenv"
-	_ "github.com/lib/pq"
-)
-
-func main() {
-	err := godotenv.Load()
-	if err != nil {
-		log.Fatal("Error loading .env file")
-	}
-
-	connStr := os.Getenv("DB_CONNECTION_STRING")
-	db, err := sql.Open("postgres", connStr)
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer db.Close()
-
-	migrationPath := filepath.Join("scripts", "002_add_role_to_users.sql")
-	content, err := os.ReadFile(migrationPath)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	_, err = db.Exec(string(content))
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	fmt.Println("Migration successful: added role column to users table.")
-}